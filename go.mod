@@ -8,6 +8,7 @@ require (
 	github.com/Financial-Times/http-handlers-go/v2 v2.3.0
 	github.com/Financial-Times/service-status-go v0.0.0-20160323111542-3f5199736a3d
 	github.com/Financial-Times/transactionid-utils-go v0.2.0
+	github.com/andybalholm/brotli v1.0.0
 	github.com/gorilla/mux v1.7.0
 	github.com/hashicorp/go-version v1.0.0 // indirect
 	github.com/jawher/mow.cli v1.0.5
@@ -16,5 +17,7 @@ require (
 	github.com/stretchr/testify v1.2.2
 	golang.org/x/crypto v0.0.0-20181030102418-4d3f4d9ffa16 // indirect
 	golang.org/x/net v0.0.0-20181106065722-10aee1819953 // indirect
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 	golang.org/x/sys v0.0.0-20181106073832-7155702f2d47 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
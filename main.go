@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/http-handlers-go/v2/httphandlers"
 	"github.com/Financial-Times/public-suggestions-api/service"
+	"github.com/Financial-Times/public-suggestions-api/stub"
 	"github.com/Financial-Times/public-suggestions-api/web"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
 	"github.com/gorilla/mux"
@@ -54,7 +56,7 @@ func main() {
 	authorsSuggestionApiBaseURL := app.String(cli.StringOpt{
 		Name:   "authors-suggestion-api-base-url",
 		Value:  "http://authors-suggestion-api:8080",
-		Desc:   "The base URL to authors suggestion api",
+		Desc:   "The base URL to authors suggestion api, or a comma separated list of base URLs to balance the requests over",
 		EnvVar: "AUTHORS_SUGGESTION_API_BASE_URL",
 	})
 	authorsSuggestionEndpoint := app.String(cli.StringOpt{
@@ -66,7 +68,7 @@ func main() {
 	ontotextSuggestionApiBaseURL := app.String(cli.StringOpt{
 		Name:   "ontotext-suggestion-api-base-url",
 		Value:  "http://ontotext-suggestion-api:8080",
-		Desc:   "The base URL to ontotext suggestion api",
+		Desc:   "The base URL to ontotext suggestion api, or a comma separated list of base URLs to balance the requests over",
 		EnvVar: "ONTOTEXT_SUGGESTION_API_BASE_URL",
 	})
 	ontotextSuggestionEndpoint := app.String(cli.StringOpt{
@@ -79,7 +81,7 @@ func main() {
 	internalConcordancesApiBaseURL := app.String(cli.StringOpt{
 		Name:   "internal-concordances-api-base-url",
 		Value:  "http://internal-concordances:8080",
-		Desc:   "The base URL for internal concordances api",
+		Desc:   "The base URL for internal concordances api, or a comma separated list of base URLs to balance the requests over",
 		EnvVar: "CONCEPT_CONCORDANCES_API_BASE_URL",
 	})
 	internalConcordancesEndpoint := app.String(cli.StringOpt{
@@ -89,10 +91,23 @@ func main() {
 		EnvVar: "CONCEPT_CONCORDANCES_ENDPOINT",
 	})
 
+	internalConcordancesSecondaryBaseURL := app.String(cli.StringOpt{
+		Name:   "internal-concordances-secondary-base-url",
+		Value:  "",
+		Desc:   "The base URL for internal concordances api in the secondary region, receiving the requests failing or timing out in the active region. Empty disables the regional failover",
+		EnvVar: "CONCEPT_CONCORDANCES_SECONDARY_BASE_URL",
+	})
+	internalConcordancesFailoverTimeout := app.Int(cli.IntOpt{
+		Name:   "internal-concordances-failover-timeout",
+		Value:  3000,
+		Desc:   "The time in milliseconds after which a request to internal concordances api fails over to the other region",
+		EnvVar: "CONCEPT_CONCORDANCES_FAILOVER_TIMEOUT",
+	})
+
 	publicThingsAPIBaseURL := app.String(cli.StringOpt{
 		Name:   "public-things-api-base-url",
 		Value:  "http://public-things-api:8080",
-		Desc:   "The base URL for public things api",
+		Desc:   "The base URL for public things api, or a comma separated list of base URLs to balance the requests over",
 		EnvVar: "PUBLIC_THINGS_API_BASE_URL",
 	})
 	publicThingsEndpoint := app.String(cli.StringOpt{
@@ -101,11 +116,35 @@ func main() {
 		Desc:   "The endpoint for public things api",
 		EnvVar: "PUBLIC_THINGS_ENDPOINT",
 	})
+	broaderExclusionMaxDepth := app.Int(cli.IntOpt{
+		Name:   "broader-exclusion-max-depth",
+		Value:  0,
+		Desc:   "The maximum distance in the concept hierarchy between a suggestion and a broader concept excluded because of it, 1 excluding only the direct broader concepts. 0 means no limit",
+		EnvVar: "BROADER_EXCLUSION_MAX_DEPTH",
+	})
+	broaderExclusionEnabledTypes := app.Strings(cli.StringsOpt{
+		Name:   "broader-exclusion-enabled-types",
+		Value:  []string{},
+		Desc:   "The concept types of the broader concepts which are excluded, among author, locationSource, organisationSource, personSource and topicSource. All of them are excluded when empty",
+		EnvVar: "BROADER_EXCLUSION_ENABLED_TYPES",
+	})
+	broaderExclusionDisabledTypes := app.Strings(cli.StringsOpt{
+		Name:   "broader-exclusion-disabled-types",
+		Value:  []string{},
+		Desc:   "The concept types of the broader concepts which are never excluded, among author, locationSource, organisationSource, personSource and topicSource",
+		EnvVar: "BROADER_EXCLUSION_DISABLED_TYPES",
+	})
+	broaderExclusionWhitelist := app.Strings(cli.StringsOpt{
+		Name:   "broader-exclusion-whitelist",
+		Value:  []string{},
+		Desc:   "The UUIDs of the concepts which are never excluded as broader concepts of other suggestions",
+		EnvVar: "BROADER_EXCLUSION_WHITELIST",
+	})
 
 	conceptBlacklisterBaseUrl := app.String(cli.StringOpt{
 		Name:   "concept-blacklister-base-url",
 		Value:  "http://concept-suggestions-blacklister:8080",
-		Desc:   "The base URL for concept suggester blacklister",
+		Desc:   "The base URL for concept suggester blacklister, or a comma separated list of base URLs to balance the requests over",
 		EnvVar: "CONCEPT_BLACKLISTER_BASE_URL",
 	})
 	conceptBlacklisterEndpoint := app.String(cli.StringOpt{
@@ -115,11 +154,246 @@ func main() {
 		EnvVar: "CONCEPT_BLACKLISTER_ENDPOINT",
 	})
 
+	loadBalancingStrategy := app.String(cli.StringOpt{
+		Name:   "load-balancing-strategy",
+		Value:  service.RoundRobin,
+		Desc:   "How the requests are balanced over the base URLs of a downstream service: round-robin or least-outstanding",
+		EnvVar: "LOAD_BALANCING_STRATEGY",
+	})
+
+	ontotextHedgingPercentile := app.Int(cli.IntOpt{
+		Name:   "ontotext-hedging-percentile",
+		Value:  0,
+		Desc:   "The percentile of the recent ontotext suggestion api latencies after which a second request is sent if the first one did not answer yet, e.g. 95. 0 disables hedged requests",
+		EnvVar: "ONTOTEXT_HEDGING_PERCENTILE",
+	})
+	ontotextHedgingMinDelay := app.Int(cli.IntOpt{
+		Name:   "ontotext-hedging-min-delay",
+		Value:  100,
+		Desc:   "The minimum time in milliseconds before a second request is sent to ontotext suggestion api",
+		EnvVar: "ONTOTEXT_HEDGING_MIN_DELAY",
+	})
+	ontotextHedgingBaseURL := app.String(cli.StringOpt{
+		Name:   "ontotext-hedging-base-url",
+		Value:  "",
+		Desc:   "The base URL to the ontotext suggestion api receiving the second requests, the same base URL is used when empty",
+		EnvVar: "ONTOTEXT_HEDGING_BASE_URL",
+	})
+
+	candidateSuggestionApiBaseURL := app.String(cli.StringOpt{
+		Name:   "candidate-suggestion-api-base-url",
+		Value:  "",
+		Desc:   "The base URL to a candidate suggestion api, called in the shadow of the others to compare its suggestions without returning them. Empty disables shadow suggestions",
+		EnvVar: "CANDIDATE_SUGGESTION_API_BASE_URL",
+	})
+	candidateSuggestionEndpoint := app.String(cli.StringOpt{
+		Name:   "candidate-suggestion-endpoint",
+		Value:  "/content/suggest",
+		Desc:   "The endpoint for the candidate suggestion api",
+		EnvVar: "CANDIDATE_SUGGESTION_ENDPOINT",
+	})
+
+	experimentName := app.String(cli.StringOpt{
+		Name:   "experiment-name",
+		Value:  "experiment",
+		Desc:   "The name of the experiment variant, used to tag its responses and metrics",
+		EnvVar: "EXPERIMENT_NAME",
+	})
+	experimentPercentage := app.Int(cli.IntOpt{
+		Name:   "experiment-percentage",
+		Value:  0,
+		Desc:   "The percentage of the content, by content ID, whose suggestions are served by the experiment variant. 0 disables the experiment",
+		EnvVar: "EXPERIMENT_PERCENTAGE",
+	})
+	experimentOntotextSuggestionEndpoint := app.String(cli.StringOpt{
+		Name:   "experiment-ontotext-suggestion-endpoint",
+		Value:  "",
+		Desc:   "The endpoint for ontotext suggestion api in the experiment variant, the control endpoint is used when empty",
+		EnvVar: "EXPERIMENT_ONTOTEXT_SUGGESTION_ENDPOINT",
+	})
+	experimentOntotextConceptTypes := app.Strings(cli.StringsOpt{
+		Name:   "experiment-ontotext-concept-types",
+		Value:  []string{},
+		Desc:   "The concept types kept from ontotext suggestions in the experiment variant, among locationSource, organisationSource, personSource and topicSource. All of them are kept when empty",
+		EnvVar: "EXPERIMENT_ONTOTEXT_CONCEPT_TYPES",
+	})
+
+	maxRequestBodySize := app.Int(cli.IntOpt{
+		Name:   "max-request-body-size",
+		Value:  2 * 1024 * 1024,
+		Desc:   "The maximum size in bytes of a suggestion request body, bigger requests are rejected with HTTP 413",
+		EnvVar: "MAX_REQUEST_BODY_SIZE",
+	})
+	maxDownstreamResponseSize := app.Int(cli.IntOpt{
+		Name:   "max-downstream-response-size",
+		Value:  10 * 1024 * 1024,
+		Desc:   "The maximum size in bytes of a response read from each downstream service",
+		EnvVar: "MAX_DOWNSTREAM_RESPONSE_SIZE",
+	})
+
+	responseCacheMaxEntries := app.Int(cli.IntOpt{
+		Name:   "response-cache-max-entries",
+		Value:  0,
+		Desc:   "The maximum number of suggestion responses kept in the response cache, 0 disables the cache",
+		EnvVar: "RESPONSE_CACHE_MAX_ENTRIES",
+	})
+	responseCacheTTL := app.Int(cli.IntOpt{
+		Name:   "response-cache-ttl",
+		Value:  300,
+		Desc:   "The time in seconds a suggestion response is kept in the response cache",
+		EnvVar: "RESPONSE_CACHE_TTL",
+	})
+	processingStages := app.Strings(cli.StringsOpt{
+		Name:   "processing-stages",
+		Value:  []string{service.ConcordanceStage, service.ConceptTypesStage, service.BroaderExclusionStage, service.BlacklistStage, service.EditorialRulesStage},
+		Desc:   "The post-processing stages of the suggestions, in the order they run, among concordance, concept-types, broader-exclusion, blacklist and editorial-rules",
+		EnvVar: "PROCESSING_STAGES",
+	})
+	editorialRulesFile := app.String(cli.StringOpt{
+		Name:   "editorial-rules-file",
+		Value:  "",
+		Desc:   "The YAML file of the editorial rules suppressing or adding concepts, no rule is applied when empty",
+		EnvVar: "EDITORIAL_RULES_FILE",
+	})
+	editorialRulesReloadInterval := app.Int(cli.IntOpt{
+		Name:   "editorial-rules-reload-interval",
+		Value:  60,
+		Desc:   "The interval in seconds between two reloads of the editorial rules file, 0 disables the reloads",
+		EnvVar: "EDITORIAL_RULES_RELOAD_INTERVAL",
+	})
+	broaderCacheMaxEntries := app.Int(cli.IntOpt{
+		Name:   "broader-cache-max-entries",
+		Value:  0,
+		Desc:   "The maximum number of concepts whose broader concepts are kept in the broader cache, 0 disables the cache",
+		EnvVar: "BROADER_CACHE_MAX_ENTRIES",
+	})
+	broaderCacheTTL := app.Int(cli.IntOpt{
+		Name:   "broader-cache-ttl",
+		Value:  3600,
+		Desc:   "The time in seconds the broader concepts of a concept are kept in the broader cache",
+		EnvVar: "BROADER_CACHE_TTL",
+	})
+	broaderCacheNegativeTTL := app.Int(cli.IntOpt{
+		Name:   "broader-cache-negative-ttl",
+		Value:  600,
+		Desc:   "The time in seconds a concept without broader concepts is kept in the broader cache",
+		EnvVar: "BROADER_CACHE_NEGATIVE_TTL",
+	})
+
+	maxInFlightRequests := app.Int(cli.IntOpt{
+		Name:   "max-in-flight-requests",
+		Value:  0,
+		Desc:   "The maximum number of suggestion requests processed concurrently, 0 disables the limit",
+		EnvVar: "MAX_IN_FLIGHT_REQUESTS",
+	})
+	maxQueuedRequests := app.Int(cli.IntOpt{
+		Name:   "max-queued-requests",
+		Value:  100,
+		Desc:   "The maximum number of suggestion requests waiting for processing in each priority lane",
+		EnvVar: "MAX_QUEUED_REQUESTS",
+	})
+	requestQueueTimeout := app.Int(cli.IntOpt{
+		Name:   "request-queue-timeout",
+		Value:  5000,
+		Desc:   "The time in milliseconds a suggestion request waits for processing before being rejected",
+		EnvVar: "REQUEST_QUEUE_TIMEOUT",
+	})
+	requestPriorityHeader := app.String(cli.StringOpt{
+		Name:   "request-priority-header",
+		Value:  "X-Request-Priority",
+		Desc:   "The request header identifying bulk callers by the value 'bulk', their requests are processed after the interactive ones",
+		EnvVar: "REQUEST_PRIORITY_HEADER",
+	})
+
+	rateLimitHeader := app.String(cli.StringOpt{
+		Name:   "rate-limit-header",
+		Value:  "X-Api-Key",
+		Desc:   "The request header identifying clients for rate limiting, e.g. X-Api-Key or client-system-code, clients without it being identified by their remote address, so that behind a gateway they all share the bucket of the gateway address",
+		EnvVar: "RATE_LIMIT_HEADER",
+	})
+	rateLimitDefaultRate := app.Int(cli.IntOpt{
+		Name:   "rate-limit-default-rate",
+		Value:  0,
+		Desc:   "The number of requests per second allowed for each client without a configured rate limit, 0 disables the limit",
+		EnvVar: "RATE_LIMIT_DEFAULT_RATE",
+	})
+	rateLimitDefaultBurst := app.Int(cli.IntOpt{
+		Name:   "rate-limit-default-burst",
+		Value:  10,
+		Desc:   "The number of requests allowed in a burst for each client without a configured rate limit",
+		EnvVar: "RATE_LIMIT_DEFAULT_BURST",
+	})
+	rateLimits := app.String(cli.StringOpt{
+		Name:   "rate-limits",
+		Value:  "",
+		Desc:   `The rate limits per client as a JSON object, e.g. {"client-a": {"rate": 10, "burst": 20}}`,
+		EnvVar: "RATE_LIMITS",
+	})
+
+	healthErrorRateThreshold := app.Int(cli.IntOpt{
+		Name:   "health-error-rate-threshold",
+		Value:  50,
+		Desc:   "The percentage of failed calls to a downstream service over the traffic window that fails its health check, 0 disables the check",
+		EnvVar: "HEALTH_ERROR_RATE_THRESHOLD",
+	})
+	healthTrafficWindow := app.Int(cli.IntOpt{
+		Name:   "health-traffic-window",
+		Value:  300,
+		Desc:   "The time in seconds over which the calls to downstream services are considered by their health checks",
+		EnvVar: "HEALTH_TRAFFIC_WINDOW",
+	})
+	healthMinCalls := app.Int(cli.IntOpt{
+		Name:   "health-min-calls",
+		Value:  20,
+		Desc:   "The minimum number of calls to a downstream service over the traffic window before its error rate can fail its health check",
+		EnvVar: "HEALTH_MIN_CALLS",
+	})
+
+	healthCheckInterval := app.Int(cli.IntOpt{
+		Name:   "health-check-interval",
+		Value:  30,
+		Desc:   "The time in seconds between background runs of the health checks, whose latest results are served by the health and GTG endpoints. 0 runs the checks on each request",
+		EnvVar: "HEALTH_CHECK_INTERVAL",
+	})
+
+	gtgCriticalChecks := app.Strings(cli.StringsOpt{
+		Name:   "gtg-critical-checks",
+		Value:  []string{},
+		Desc:   "The IDs of the health checks failing GTG when they fail, e.g. internal-concordances. By default the service is always good to go",
+		EnvVar: "GTG_CRITICAL_CHECKS",
+	})
+
+	stubMode := app.Bool(cli.BoolOpt{
+		Name:   "stub",
+		Value:  false,
+		Desc:   "Serve the downstream services in process from the stub fixtures, to run the service without any of its dependencies",
+		EnvVar: "STUB",
+	})
+	stubFixtures := app.String(cli.StringOpt{
+		Name:   "stub-fixtures",
+		Value:  "_ft/ersatz-fixtures.yml",
+		Desc:   "The file with the fixture responses of the downstream services used in stub mode",
+		EnvVar: "STUB_FIXTURES",
+	})
+
+	recordingDir := app.String(cli.StringOpt{
+		Name:   "recording-dir",
+		Value:  "",
+		Desc:   "The directory in which the downstream requests and responses of transactions are recorded, to be replayed in tests. Empty disables recording",
+		EnvVar: "RECORDING_DIR",
+	})
+	recordedTransactionIDs := app.Strings(cli.StringsOpt{
+		Name:   "recorded-transaction-ids",
+		Value:  []string{},
+		Desc:   "The IDs of the transactions to record, all of them are recorded by default",
+		EnvVar: "RECORDED_TRANSACTION_IDS",
+	})
+
 	log := logger.NewUPPLogger(*appSystemCode, *logLevel)
 	app.Action = func() {
 		log.Infof("App Name: %s, Port: %s", *appName, *port)
 
-		c := &http.Client{
+		var c service.Client = &http.Client{
 			Transport: &http.Transport{
 				MaxIdleConnsPerHost: 128,
 				DialContext: (&net.Dialer{
@@ -129,17 +403,152 @@ func main() {
 			},
 			Timeout: 10 * time.Second,
 		}
+		if *stubMode {
+			fixtures, err := stub.LoadFixtures(*stubFixtures)
+			if err != nil {
+				log.WithError(err).Fatal("Stub fixtures could not be loaded")
+			}
+			log.Warnf("Running in stub mode, downstream services are served from %s", *stubFixtures)
+			c = stub.NewClient(stub.NewHandler(fixtures))
+		}
 
-		authorsSuggester := service.NewAuthorsSuggester(*authorsSuggestionApiBaseURL, *authorsSuggestionEndpoint, c)
-		ontotextSuggester := service.NewOntotextSuggester(*ontotextSuggestionApiBaseURL, *ontotextSuggestionEndpoint, c)
-		broaderService := service.NewBroaderConceptsProvider(*publicThingsAPIBaseURL, *publicThingsEndpoint, c)
+		maxResponseSize := int64(*maxDownstreamResponseSize)
+		// downstream builds the client of a downstream service, balancing its requests when it has several base URLs
+		downstream := func(name string, baseURLs string) (string, service.Client) {
+			var client service.Client = service.NewSizeLimitedClient(name, c, maxResponseSize)
+			if *recordingDir != "" {
+				client = stub.NewRecordingClient(client, *recordingDir, *recordedTransactionIDs...)
+			}
+			urls := strings.Split(baseURLs, ",")
+			for i := range urls {
+				urls[i] = strings.TrimSpace(urls[i])
+			}
+			if len(urls) == 1 {
+				return urls[0], client
+			}
+			balanced, err := service.NewBalancedClient(name, urls, *loadBalancingStrategy, client)
+			if err != nil {
+				log.WithError(err).Fatalf("Endpoints of %s are not valid", name)
+			}
+			return urls[0], balanced
+		}
+
+		authorsBaseURL, authorsClient := downstream("authors-suggestion-api", *authorsSuggestionApiBaseURL)
+		ontotextBaseURL, ontotextClient := downstream("ontotext-suggestion-api", *ontotextSuggestionApiBaseURL)
+		publicThingsBaseURL, publicThingsClient := downstream("public-things-api", *publicThingsAPIBaseURL)
+		concordancesBaseURL, concordancesClient := downstream("internal-concordances", *internalConcordancesApiBaseURL)
+		blacklisterBaseURL, blacklisterClient := downstream("concept-suggestions-blacklister", *conceptBlacklisterBaseUrl)
+
+		authorsSuggester := service.NewAuthorsSuggester(authorsBaseURL, *authorsSuggestionEndpoint, authorsClient)
+		ontotextSuggester := service.NewOntotextSuggester(ontotextBaseURL, *ontotextSuggestionEndpoint, ontotextClient)
+		broaderService := service.NewBroaderConceptsProvider(publicThingsBaseURL, *publicThingsEndpoint, publicThingsClient)
+
+		concordanceService := service.NewConcordance(concordancesBaseURL, *internalConcordancesEndpoint, concordancesClient)
+		blacklister := service.NewConceptBlacklister(blacklisterBaseURL, *conceptBlacklisterEndpoint, blacklisterClient)
+		newTrafficMonitor := func() *service.TrafficMonitor {
+			return service.NewTrafficMonitor(time.Duration(*healthTrafficWindow)*time.Second, float64(*healthErrorRateThreshold)/100, *healthMinCalls)
+		}
+		authorsSuggester.MonitorTraffic(newTrafficMonitor())
+		ontotextSuggester.MonitorTraffic(newTrafficMonitor())
+		if *ontotextHedgingPercentile > 0 {
+			ontotextSuggester.HedgeRequests(service.HedgingPolicy{
+				Percentile:       float64(*ontotextHedgingPercentile) / 100,
+				MinDelay:         time.Duration(*ontotextHedgingMinDelay) * time.Millisecond,
+				AlternateBaseURL: *ontotextHedgingBaseURL,
+			})
+		}
+		broaderService.MonitorTraffic(newTrafficMonitor())
+		err := broaderService.SetExclusionRules(service.BroaderExclusionRules{
+			MaxDepth:      *broaderExclusionMaxDepth,
+			EnabledTypes:  *broaderExclusionEnabledTypes,
+			DisabledTypes: *broaderExclusionDisabledTypes,
+			Whitelist:     *broaderExclusionWhitelist,
+		})
+		if err != nil {
+			log.WithError(err).Fatal("Broader exclusion rules are not valid")
+		}
+		// cached broader concepts are not fetched again, so they would be missing from the recordings
+		if *broaderCacheMaxEntries > 0 && *recordingDir != "" {
+			log.Warn("Broader cache disabled while recording transactions")
+		} else if *broaderCacheMaxEntries > 0 {
+			broaderService.CacheBroaderConcepts(service.NewBroaderCache(time.Duration(*broaderCacheTTL)*time.Second, time.Duration(*broaderCacheNegativeTTL)*time.Second, *broaderCacheMaxEntries))
+		}
+		concordanceService.MonitorTraffic(newTrafficMonitor())
+		if *internalConcordancesSecondaryBaseURL != "" {
+			concordanceService.FailoverTo(*internalConcordancesSecondaryBaseURL, time.Duration(*internalConcordancesFailoverTimeout)*time.Millisecond)
+		}
+		blacklister.MonitorTraffic(newTrafficMonitor())
 
-		concordanceService := service.NewConcordance(*internalConcordancesApiBaseURL, *internalConcordancesEndpoint, c)
-		blacklister := service.NewConceptBlacklister(*conceptBlacklisterBaseUrl, *conceptBlacklisterEndpoint, c)
 		suggester := service.NewAggregateSuggester(log, concordanceService, broaderService, blacklister, authorsSuggester, ontotextSuggester)
+		// collapsed requests are only recorded for the transaction which made them, so they would be missing from the other recordings
+		if *recordingDir != "" {
+			log.Warn("Request collapsing disabled while recording transactions")
+			suggester.DisableRequestCollapsing()
+			concordanceService.DisableRequestCollapsing()
+			blacklister.DisableRequestCollapsing()
+		}
+		editorialRules := &service.EditorialRulesProcessor{}
+		if *editorialRulesFile != "" {
+			editorialRules.Rules, err = service.LoadEditorialRules(*editorialRulesFile, log)
+			if err != nil {
+				log.WithError(err).Fatal("Editorial rules are not valid")
+			}
+			stopEditorialRulesReload := editorialRules.Rules.ReloadInBackground(time.Duration(*editorialRulesReloadInterval) * time.Second)
+			defer stopEditorialRulesReload()
+		}
+		suggester.Pipeline, err = service.NewPipeline(*processingStages, append(service.DefaultPipeline(concordanceService, broaderService, blacklister), editorialRules)...)
+		if err != nil {
+			log.WithError(err).Fatal("Processing stages are not valid")
+		}
+		if *experimentPercentage > 0 {
+			var experimentOntotextSuggester service.Suggester = ontotextSuggester
+			if *experimentOntotextSuggestionEndpoint != "" {
+				alternate := service.NewOntotextSuggester(ontotextBaseURL, *experimentOntotextSuggestionEndpoint, ontotextClient)
+				alternate.MonitorTraffic(newTrafficMonitor())
+				experimentOntotextSuggester = alternate
+			}
+			if len(*experimentOntotextConceptTypes) > 0 {
+				filtered, err := service.NewFilteredSuggester(experimentOntotextSuggester, *experimentOntotextConceptTypes...)
+				if err != nil {
+					log.WithError(err).Fatal("Experiment is not valid")
+				}
+				experimentOntotextSuggester = filtered
+			}
+			suggester.Experiment = &service.Experiment{
+				Name:       *experimentName,
+				Percentage: *experimentPercentage,
+				Suggesters: []service.Suggester{authorsSuggester, experimentOntotextSuggester},
+			}
+		}
+		if *candidateSuggestionApiBaseURL != "" {
+			candidateBaseURL, candidateClient := downstream("candidate-suggestion-api", *candidateSuggestionApiBaseURL)
+			suggester.Shadows = append(suggester.Shadows, service.NewCandidateSuggester("candidate-suggestion-api", candidateBaseURL, *candidateSuggestionEndpoint, candidateClient))
+		}
+		// cached responses make no downstream request, so they would be missing from the recordings
+		if *responseCacheMaxEntries > 0 && *recordingDir != "" {
+			log.Warn("Response cache disabled while recording transactions")
+		} else if *responseCacheMaxEntries > 0 {
+			suggester.Cache = service.NewResponseCache(time.Duration(*responseCacheTTL)*time.Second, *responseCacheMaxEntries)
+		}
 		healthService := web.NewHealthService(*appSystemCode, *appName, appDescription, authorsSuggester.Check(), ontotextSuggester.Check(), concordanceService.Check(), broaderService.Check(), blacklister.Check())
+		if err := healthService.SetCriticalChecks(*gtgCriticalChecks); err != nil {
+			log.WithError(err).Fatal("GTG policy is not valid")
+		}
+		if *healthCheckInterval > 0 {
+			stopHealthChecks := healthService.RunChecksInBackground(time.Duration(*healthCheckInterval) * time.Second)
+			defer stopHealthChecks()
+		}
+
+		clientRateLimits, err := web.ParseRateLimits(*rateLimits)
+		if err != nil {
+			log.WithError(err).Fatal("Rate limits are not valid")
+		}
+		rateLimiter := web.NewRateLimiter(*rateLimitHeader, web.RateLimit{Rate: float64(*rateLimitDefaultRate), Burst: *rateLimitDefaultBurst}, clientRateLimits)
+		admission := web.NewAdmissionController(*maxInFlightRequests, *maxQueuedRequests, time.Duration(*requestQueueTimeout)*time.Millisecond, *requestPriorityHeader)
 
-		serveEndpoints(*port, web.NewRequestHandler(suggester, log), healthService, log)
+		serveEndpoints(*port, web.NewRequestHandler(suggester, log, int64(*maxRequestBodySize)), admission, rateLimiter, healthService, log)
+		// let the shadow comparisons of the last requests complete
+		suggester.WaitForShadows()
 
 	}
 	err := app.Run(os.Args)
@@ -149,7 +558,7 @@ func main() {
 	}
 }
 
-func serveEndpoints(port string, handler *web.RequestHandler, healthService *web.HealthService, log *logger.UPPLogger) {
+func serveEndpoints(port string, handler *web.RequestHandler, admission *web.AdmissionController, rateLimiter *web.RateLimiter, healthService *web.HealthService, log *logger.UPPLogger) {
 
 	serveMux := http.NewServeMux()
 
@@ -158,9 +567,11 @@ func serveEndpoints(port string, handler *web.RequestHandler, healthService *web
 	serveMux.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
 
 	servicesRouter := mux.NewRouter()
-	servicesRouter.HandleFunc(suggestPath, handler.HandleSuggestion).Methods(http.MethodPost)
+	servicesRouter.Handle(suggestPath, admission.Handler(http.HandlerFunc(handler.HandleSuggestion))).Methods(http.MethodPost)
 
 	var monitoringRouter http.Handler = servicesRouter
+	monitoringRouter = web.CompressionHandler(monitoringRouter)
+	monitoringRouter = rateLimiter.Handler(monitoringRouter)
 	monitoringRouter = httphandlers.TransactionAwareRequestLoggingHandler(log, monitoringRouter)
 	monitoringRouter = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, monitoringRouter)
 
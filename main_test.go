@@ -255,8 +255,9 @@ func TestRequestHandler_all(t *testing.T) {
 	healthService := web.NewHealthService("mock", "mock", "", authorsSuggester.Check(), ontotextSuggester.Check(), broaderProvider.Check())
 
 	go func() {
-		serveEndpoints("8081", web.NewRequestHandler(suggester, log), healthService, log)
+		serveEndpoints("8081", web.NewRequestHandler(suggester, log, 0), web.NewAdmissionController(0, 0, 0, ""), web.NewRateLimiter("", web.RateLimit{}, nil), healthService, log)
 	}()
+	waitForServer(t, "localhost:8081")
 	client := &http.Client{}
 
 	for _, test := range tests {
@@ -267,8 +268,7 @@ func TestRequestHandler_all(t *testing.T) {
 
 		assert.Equalf(t, test.expectedStatus, res.StatusCode, "%s -> unexpected status code", test.testName)
 		if test.expectedStatus == http.StatusOK {
-			rBody := make([]byte, res.ContentLength)
-			_, _ = res.Body.Read(rBody)
+			rBody, _ := ioutil.ReadAll(res.Body)
 			res.Body.Close()
 
 			suggestionsResponse := service.SuggestionsResponse{}
@@ -282,3 +282,15 @@ func TestRequestHandler_all(t *testing.T) {
 	}
 
 }
+
+func waitForServer(t *testing.T, addr string) {
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("server on %s did not start", addr)
+}
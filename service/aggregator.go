@@ -2,10 +2,12 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	fp "path/filepath"
 	"sync"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
 )
 
 const PanicGuideURL = "https://runbooks.in.ft.com/"
@@ -16,6 +18,18 @@ type AggregateSuggester struct {
 	Blacklister     ConceptBlacklister
 	Suggesters      []Suggester
 	Log             *logger.UPPLogger
+	// Cache is optional, when set identical requests are answered from it without calling the downstream services
+	Cache *ResponseCache
+	// Experiment is optional, when set it routes part of the requests to alternate suggesters
+	Experiment *Experiment
+	// Shadows are optional, they get the same requests as Suggesters but their suggestions are only compared with the returned ones
+	Shadows []Suggester
+	// Pipeline is optional, it replaces the default post-processing stages built from Concordance, BroaderProvider and Blacklister
+	Pipeline Pipeline
+	// inFlight collapses concurrent identical requests into a single set of downstream calls
+	inFlight requestCollapser
+	// shadows tracks the comparisons of the shadow suggestions running in the background
+	shadows sync.WaitGroup
 }
 
 func NewAggregateSuggester(log *logger.UPPLogger, concordance *ConcordanceService, broaderConceptsProvider *BroaderConceptsProvider, blacklister ConceptBlacklister, suggesters ...Suggester) *AggregateSuggester {
@@ -38,13 +52,71 @@ func (s *AggregateSuggester) GetSuggestions(payload []byte, tid string) (Suggest
 
 	logEntry.Debugf("transformed payload: %s", string(data))
 
+	variant, suggesters := s.route(data)
+	if variant != "" {
+		logEntry.Debugf("suggestions served by the %s variant", variant)
+	}
+
+	content := getContentAttributes(payload)
+	key := CacheKey(data, variant, content.Type)
+	result, err, shared := s.inFlight.Do(key, func() (interface{}, error) {
+		return s.aggregateSuggestions(data, content, key, suggesters, tid)
+	})
+	if shared {
+		logEntry.Debug("Suggestions request collapsed with an identical in-flight request")
+	}
+	// waiters share the same result, so each gets its own copy
+	response := copySuggestionsResponse(result.(SuggestionsResponse))
+	response.Variant = variant
+	if variant != "" && err == nil {
+		metrics.GetOrRegisterHistogram(fmt.Sprintf("suggest.variant.%s.suggestions", variant), metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015)).Update(int64(len(response.Suggestions)))
+	}
+	return response, err
+}
+
+// DisableRequestCollapsing makes identical concurrent requests call the downstream services separately, e.g. so that each transaction is recorded in full
+func (s *AggregateSuggester) DisableRequestCollapsing() {
+	s.inFlight.disabled = true
+}
+
+func (s *AggregateSuggester) aggregateSuggestions(data []byte, content ContentAttributes, cacheKey string, suggesters []Suggester, tid string) (SuggestionsResponse, error) {
+	logEntry := s.Log.WithTransactionID(tid)
+	pipeline := s.pipeline()
+
 	var aggregateResp = SuggestionsResponse{Suggestions: make([]Suggestion, 0)}
 	var responseMap = map[int][]Suggestion{}
 
 	var mutex = sync.Mutex{}
 	var wg = sync.WaitGroup{}
 
-	for key, suggesterDelegate := range s.Suggesters {
+	var blacklist Blacklist
+	var blacklistErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		blacklist, blacklistErr = s.Blacklister.GetBlacklist(tid)
+		if blacklistErr != nil {
+			logEntry.WithError(blacklistErr).Errorf("Error retrieving concept blacklist, filtering disabled")
+		}
+	}()
+
+	// only complete responses filtered by a known blacklist version are cached
+	cacheable := s.Cache != nil
+	if cacheable {
+		// the blacklist being retrieved along with the suggestions, cached responses are validated against the blacklist retrieved last.
+		// Responses are also invalidated when the data of the versioned stages changes.
+		if last, found := s.Blacklister.LastBlacklist(); found {
+			if cached, found := s.Cache.Get(cacheKey, last.Version()+pipeline.Version()); found {
+				logEntry.Debug("Serving suggestions from the response cache")
+				return cached, nil
+			}
+		}
+	}
+
+	shadowResponse := s.runShadows(data, pipeline, tid)
+	defer close(shadowResponse)
+
+	for key, suggesterDelegate := range suggesters {
 		wg.Add(1)
 		logEntry := logEntry
 		go func(i int, delegate Suggester) {
@@ -56,6 +128,9 @@ func (s *AggregateSuggester) GetSuggestions(payload []byte, tid string) (Suggest
 					errEntry.Warn(errMsg)
 				} else {
 					errEntry.Error(errMsg)
+					mutex.Lock()
+					cacheable = false
+					mutex.Unlock()
 				}
 			}
 			mutex.Lock()
@@ -66,50 +141,41 @@ func (s *AggregateSuggester) GetSuggestions(payload []byte, tid string) (Suggest
 
 	}
 
-	var blacklist Blacklist
-	wg.Add(1)
-	go func(b Blacklist) {
-		defer wg.Done()
-		blacklist, err = s.Blacklister.GetBlacklist(tid)
-		if err != nil {
-			logEntry.WithError(err).Errorf("Error retrieving concept blacklist, filtering disabled")
-		}
-	}(blacklist)
-
 	wg.Wait()
+	if blacklistErr != nil {
+		cacheable = false
+	}
 
-	responseMap, err = s.filterByInternalConcordances(responseMap, tid)
+	request := &ProcessingRequest{TID: tid, Log: logEntry, Suggesters: suggesters, Blacklist: blacklist, Content: content}
+	responseMap, err := pipeline.Run(request, responseMap)
 	if err != nil {
 		return aggregateResp, err
 	}
-
-	for key, suggesterDelegate := range s.Suggesters {
-		if len(responseMap[key]) > 0 {
-			responseMap[key] = suggesterDelegate.FilterSuggestions(responseMap[key])
-		}
+	if request.incomplete {
+		cacheable = false
 	}
 
-	results, err := s.BroaderProvider.excludeBroaderConceptsFromResponse(responseMap, tid)
-	if err != nil {
-		logEntry.WithError(err).Warn("Couldn't exclude broader concepts. Response might contain broader concepts as well")
-	} else {
-		responseMap = results
+	// preserve results order
+	for i := 0; i < len(suggesters); i++ {
+		aggregateResp.Suggestions = append(aggregateResp.Suggestions, responseMap[i]...)
 	}
 
-	// preserve results order
-	for i := 0; i < len(s.Suggesters); i++ {
-		for _, suggestion := range responseMap[i] {
-			if !s.Blacklister.IsBlacklisted(suggestion.ID, blacklist) {
-				aggregateResp.Suggestions = append(aggregateResp.Suggestions, suggestion)
-			}
-		}
+	if cacheable {
+		s.Cache.Set(cacheKey, blacklist.Version()+pipeline.Version(), aggregateResp)
 	}
+	shadowResponse <- primaryResult{response: copySuggestionsResponse(aggregateResp), request: request}
 	return aggregateResp, nil
 }
 
-func (s *AggregateSuggester) filterByInternalConcordances(suggestions map[int][]Suggestion, tid string) (map[int][]Suggestion, error) {
-	logEntry := s.Log.WithTransactionID(tid)
+func (s *AggregateSuggester) pipeline() Pipeline {
+	if s.Pipeline != nil {
+		return s.Pipeline
+	}
+	return DefaultPipeline(s.Concordance, s.BroaderProvider, s.Blacklister)
+}
 
+// concordSuggestions replaces the suggested concepts by their canonical concepts, dropping the concepts unknown to internal concordances
+func concordSuggestions(concordance *ConcordanceService, logEntry *logger.LogEntry, suggestions map[int][]Suggestion, tid string) (map[int][]Suggestion, error) {
 	logEntry.Debug("Calling internal concordances")
 
 	var filtered = map[int][]Suggestion{}
@@ -129,7 +195,7 @@ func (s *AggregateSuggester) filterByInternalConcordances(suggestions map[int][]
 		return filtered, nil
 	}
 
-	concorded, err := s.Concordance.getConcordances(ids, tid)
+	concorded, err := concordance.getConcordances(ids, tid)
 	if err != nil {
 		return filtered, err
 	}
@@ -7,9 +7,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 
@@ -752,3 +755,116 @@ func TestAggregateSuggester_GetSuggestionsWithBlacklistError(t *testing.T) {
 
 	suggestionApi.AssertExpectations(t)
 }
+
+type blockingSuggester struct {
+	calls   int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSuggester) GetSuggestions(payload []byte, tid string) (SuggestionsResponse, error) {
+	atomic.AddInt32(&b.calls, 1)
+	close(b.started)
+	<-b.release
+	return SuggestionsResponse{Suggestions: []Suggestion{}}, nil
+}
+
+func (b *blockingSuggester) FilterSuggestions(suggestions []Suggestion) []Suggestion {
+	return suggestions
+}
+
+func (b *blockingSuggester) GetName() string {
+	return "Blocking Suggestion API"
+}
+
+func (b *blockingSuggester) GetSystemID() string {
+	return "blocking-suggestion-api"
+}
+
+func TestAggregateSuggester_GetSuggestionsCollapsesIdenticalRequests(t *testing.T) {
+	expect := assert.New(t)
+
+	log := logger.NewUPPLogger("test-service", "panic")
+	suggester := &blockingSuggester{started: make(chan struct{}), release: make(chan struct{})}
+
+	blacklisterMock := new(mockHttpClient)
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	blacklister := NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
+
+	aggregateSuggester := NewAggregateSuggester(log, NewConcordance("internalConcordancesHost", "/internalconcordances", new(mockHttpClient)), NewBroaderConceptsProvider("publicThingsUrl", "/things", new(mockHttpClient)), blacklister, suggester)
+
+	responses := make(chan SuggestionsResponse, 2)
+	go func() {
+		response, _ := aggregateSuggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_first")
+		responses <- response
+	}()
+	<-suggester.started
+
+	go func() {
+		// the same content in a different JSON layout results in the same transformed payload
+		response, _ := aggregateSuggester.GetSuggestions([]byte(`{ "bodyXML" : "Test   body" }`), "tid_second")
+		responses <- response
+	}()
+	// give the second request time to join the in-flight one
+	time.Sleep(100 * time.Millisecond)
+	close(suggester.release)
+
+	expect.Equal(SuggestionsResponse{Suggestions: []Suggestion{}}, <-responses)
+	expect.Equal(SuggestionsResponse{Suggestions: []Suggestion{}}, <-responses)
+	expect.Equal(int32(1), atomic.LoadInt32(&suggester.calls))
+	blacklisterMock.AssertExpectations(t)
+}
+
+func TestAggregateSuggester_GetSuggestionsLooksUpBroaderConceptsWithConcordances(t *testing.T) {
+	expect := assert.New(t)
+
+	// each lookup only answers once the other one started, which never happens if they run one after the other
+	concordancesStarted := make(chan struct{})
+	thingsStarted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/internalconcordances":
+			close(concordancesStarted)
+			select {
+			case <-thingsStarted:
+			case <-time.After(2 * time.Second):
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+			w.Write([]byte(`{"concepts": {
+				"paris-source": {"id": "http://www.ft.com/thing/paris", "prefLabel": "Paris", "type": "http://www.ft.com/ontology/Location"},
+				"france-source": {"id": "http://www.ft.com/thing/france", "prefLabel": "France", "type": "http://www.ft.com/ontology/Location"}
+			}}`))
+		case "/things":
+			close(thingsStarted)
+			select {
+			case <-concordancesStarted:
+			case <-time.After(2 * time.Second):
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+			// public things resolves the source IDs to their canonical concepts
+			w.Write([]byte(`{"things": {
+				"paris-source": {"id": "http://www.ft.com/thing/paris", "broaderConcepts": [{"id": "http://www.ft.com/thing/france"}]}
+			}}`))
+		case "/blacklist":
+			w.Write([]byte(`{"uuids": []}`))
+		}
+	}))
+	defer server.Close()
+
+	suggester := NewAggregateSuggester(logger.NewUPPLogger("test-service", "panic"),
+		NewConcordance(server.URL, "/internalconcordances", http.DefaultClient),
+		NewBroaderConceptsProvider(server.URL, "/things", http.DefaultClient),
+		NewConceptBlacklister(server.URL, "/blacklist", http.DefaultClient),
+		&staticSuggester{name: "Test Suggestion API", response: locations("paris-source", "france-source")})
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	if expect.Len(response.Suggestions, 1) {
+		expect.Equal("http://www.ft.com/thing/paris", response.Suggestions[0].ID)
+	}
+}
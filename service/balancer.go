@@ -0,0 +1,233 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	RoundRobin       = "round-robin"
+	LeastOutstanding = "least-outstanding"
+
+	defaultEndpointCooldown = 10 * time.Second
+)
+
+// BalancedClient spreads the requests to a downstream service over several endpoints of it, either in turn or to the endpoint with the fewest outstanding requests.
+// Endpoints failing a request or a health check are avoided, and failed requests are retried on another endpoint.
+// Requests are made to the first endpoint by the services, and only their base URL is replaced.
+type BalancedClient struct {
+	name      string
+	client    Client
+	strategy  string
+	cooldown  time.Duration
+	mutex     sync.Mutex
+	endpoints []*endpoint
+	next      int
+	now       func() time.Time
+	failovers metrics.Counter
+}
+
+type endpoint struct {
+	baseURL     string
+	outstanding int
+	// failing requests make the endpoint unhealthy until the cooldown is over, failing health checks until a health check passes
+	unhealthyUntil time.Time
+	checkFailed    bool
+	lastError      string
+}
+
+func NewBalancedClient(name string, baseURLs []string, strategy string, client Client) (*BalancedClient, error) {
+	if len(baseURLs) == 0 {
+		return nil, fmt.Errorf("no endpoint for %s", name)
+	}
+	if strategy != RoundRobin && strategy != LeastOutstanding {
+		return nil, fmt.Errorf("unknown load balancing strategy %q", strategy)
+	}
+
+	c := &BalancedClient{
+		name:      name,
+		client:    client,
+		strategy:  strategy,
+		cooldown:  defaultEndpointCooldown,
+		now:       time.Now,
+		failovers: metrics.GetOrRegisterCounter("downstream."+name+".failovers", metrics.DefaultRegistry),
+	}
+	for _, baseURL := range baseURLs {
+		c.endpoints = append(c.endpoints, &endpoint{baseURL: strings.TrimRight(baseURL, "/")})
+	}
+	return c, nil
+}
+
+func (c *BalancedClient) Do(req *http.Request) (*http.Response, error) {
+	target := req.URL.String()
+	if !strings.HasPrefix(target, c.endpoints[0].baseURL) {
+		return c.client.Do(req)
+	}
+	path := strings.TrimPrefix(target, c.endpoints[0].baseURL)
+
+	tried := make(map[*endpoint]bool, len(c.endpoints))
+	for {
+		e := c.pick(tried)
+		tried[e] = true
+
+		attempt, err := c.requestTo(req, e.baseURL+path)
+		if err != nil {
+			c.release(e, nil)
+			return nil, err
+		}
+		resp, err := c.client.Do(attempt)
+		failure := err
+		if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+			failure = fmt.Errorf("%s returned HTTP %d", e.baseURL, resp.StatusCode)
+		}
+		if req.Context().Err() != nil {
+			// cancelled by the caller, which says nothing about the endpoint
+			c.release(e, nil)
+			return resp, err
+		}
+		c.release(e, failure)
+
+		canRetry := len(tried) < len(c.endpoints) && (req.Body == nil || req.GetBody != nil)
+		if failure == nil || !canRetry {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		c.failovers.Inc(1)
+	}
+}
+
+// requestTo copies the request for the given URL, with a fresh body
+func (c *BalancedClient) requestTo(req *http.Request, target string) (*http.Request, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	attempt := req.Clone(req.Context())
+	attempt.URL = u
+	attempt.Host = ""
+	if req.GetBody != nil {
+		if attempt.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return attempt, nil
+}
+
+// pick chooses among the healthy endpoints not tried yet, or among all the endpoints not tried yet when none of them is healthy
+func (c *BalancedClient) pick(tried map[*endpoint]bool) *endpoint {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	var chosen *endpoint
+	chosenIndex := 0
+	for _, healthyOnly := range []bool{true, false} {
+		for i := 0; i < len(c.endpoints); i++ {
+			index := (c.next + i) % len(c.endpoints)
+			e := c.endpoints[index]
+			if tried[e] || (healthyOnly && !e.healthy(now)) {
+				continue
+			}
+			if chosen == nil || (c.strategy == LeastOutstanding && e.outstanding < chosen.outstanding) {
+				chosen, chosenIndex = e, index
+			}
+			if c.strategy == RoundRobin {
+				break
+			}
+		}
+		if chosen != nil {
+			break
+		}
+	}
+
+	c.next = chosenIndex + 1
+	chosen.outstanding++
+	return chosen
+}
+
+func (c *BalancedClient) release(e *endpoint, failure error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e.outstanding--
+	if failure != nil {
+		e.unhealthyUntil = c.now().Add(c.cooldown)
+		e.lastError = failure.Error()
+	} else {
+		e.unhealthyUntil = time.Time{}
+	}
+}
+
+func (e *endpoint) healthy(now time.Time) bool {
+	return !e.checkFailed && !now.Before(e.unhealthyUntil)
+}
+
+// balances tells whether the requests to the given base URL are balanced
+func (c *BalancedClient) balances(baseURL string) bool {
+	return strings.TrimRight(baseURL, "/") == c.endpoints[0].baseURL
+}
+
+// CheckEndpoints calls the given health check path on all the endpoints, failing when none of them is healthy.
+// Endpoints failing the health check do not get requests until they pass it again.
+func (c *BalancedClient) CheckEndpoints(path string) (string, error) {
+	failures := make([]error, len(c.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range c.endpoints {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+			failures[i] = c.checkEndpoint(e.baseURL + path)
+		}(i, e)
+	}
+	wg.Wait()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	healthy := 0
+	var unhealthy []string
+	for i, e := range c.endpoints {
+		e.checkFailed = failures[i] != nil
+		if e.checkFailed {
+			e.lastError = failures[i].Error()
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", e.baseURL, e.lastError))
+		} else {
+			healthy++
+		}
+	}
+
+	summary := fmt.Sprintf("%d of %d endpoints healthy", healthy, len(c.endpoints))
+	if len(unhealthy) > 0 {
+		summary += " (" + strings.Join(unhealthy, "; ") + ")"
+	}
+	if healthy == 0 {
+		return "", fmt.Errorf("%s", summary)
+	}
+	return summary, nil
+}
+
+func (c *BalancedClient) checkEndpoint(target string) error {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("User-Agent", "UPP public-suggestions-api")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Health check returned a non-200 HTTP status: %v", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// newEndpoint serves the given status, recording the bodies of the requests it got
+func newEndpoint(status int, bodies *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/__gtg" {
+			*bodies = append(*bodies, string(body))
+		}
+		w.WriteHeader(status)
+	}))
+}
+
+func post(client Client, url string, body string) (*http.Response, error) {
+	req, _ := http.NewRequest("POST", url, bytes.NewReader([]byte(body)))
+	return client.Do(req)
+}
+
+func TestBalancedClient_RoundRobin(t *testing.T) {
+	expect := assert.New(t)
+
+	var first, second []string
+	server1 := newEndpoint(http.StatusOK, &first)
+	defer server1.Close()
+	server2 := newEndpoint(http.StatusOK, &second)
+	defer server2.Close()
+
+	client, err := NewBalancedClient("test-round-robin", []string{server1.URL, server2.URL}, RoundRobin, http.DefaultClient)
+	expect.NoError(err)
+
+	for _, body := range []string{"a", "b", "c"} {
+		resp, err := post(client, server1.URL+"/content/suggest", body)
+		expect.NoError(err)
+		expect.Equal(http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+	expect.Equal([]string{"a", "c"}, first)
+	expect.Equal([]string{"b"}, second)
+}
+
+func TestBalancedClient_LeastOutstanding(t *testing.T) {
+	expect := assert.New(t)
+
+	client, err := NewBalancedClient("test-least-outstanding", []string{"http://one", "http://two", "http://three"}, LeastOutstanding, http.DefaultClient)
+	expect.NoError(err)
+
+	busy := client.pick(map[*endpoint]bool{})
+	expect.Equal("http://one", busy.baseURL)
+	expect.Equal("http://two", client.pick(map[*endpoint]bool{}).baseURL)
+	client.release(client.endpoints[1], nil)
+	// the first endpoint still has an outstanding request, ties are broken in turn
+	expect.Equal("http://three", client.pick(map[*endpoint]bool{}).baseURL)
+	expect.Equal("http://two", client.pick(map[*endpoint]bool{}).baseURL)
+}
+
+func TestBalancedClient_FailoverOnServerError(t *testing.T) {
+	expect := assert.New(t)
+
+	var failing, working []string
+	server1 := newEndpoint(http.StatusServiceUnavailable, &failing)
+	defer server1.Close()
+	server2 := newEndpoint(http.StatusOK, &working)
+	defer server2.Close()
+
+	client, err := NewBalancedClient("test-failover", []string{server1.URL, server2.URL}, RoundRobin, http.DefaultClient)
+	expect.NoError(err)
+	failovers := metrics.GetOrRegisterCounter("downstream.test-failover.failovers", metrics.DefaultRegistry).Count()
+
+	resp, err := post(client, server1.URL+"/content/suggest", "a")
+	expect.NoError(err)
+	expect.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	expect.Equal([]string{"a"}, failing)
+	expect.Equal([]string{"a"}, working)
+	expect.Equal(failovers+1, metrics.GetOrRegisterCounter("downstream.test-failover.failovers", metrics.DefaultRegistry).Count())
+
+	// the failing endpoint is avoided during the cooldown
+	resp, err = post(client, server1.URL+"/content/suggest", "b")
+	expect.NoError(err)
+	resp.Body.Close()
+	expect.Equal([]string{"a"}, failing)
+	expect.Equal([]string{"a", "b"}, working)
+
+	client.now = func() time.Time { return time.Now().Add(defaultEndpointCooldown) }
+	resp, err = post(client, server1.URL+"/content/suggest", "c")
+	expect.NoError(err)
+	resp.Body.Close()
+	expect.Equal([]string{"a", "c"}, failing)
+}
+
+func TestBalancedClient_AllEndpointsFailing(t *testing.T) {
+	expect := assert.New(t)
+
+	var first, second []string
+	server1 := newEndpoint(http.StatusInternalServerError, &first)
+	defer server1.Close()
+	server2 := newEndpoint(http.StatusBadGateway, &second)
+	defer server2.Close()
+
+	client, err := NewBalancedClient("test-all-failing", []string{server1.URL, server2.URL}, RoundRobin, http.DefaultClient)
+	expect.NoError(err)
+
+	resp, err := post(client, server1.URL+"/content/suggest", "a")
+	expect.NoError(err)
+	expect.Equal(http.StatusBadGateway, resp.StatusCode)
+	resp.Body.Close()
+
+	// unhealthy endpoints are still tried when none is healthy
+	resp, err = post(client, server1.URL+"/content/suggest", "b")
+	expect.NoError(err)
+	resp.Body.Close()
+	expect.Equal([]string{"a", "b"}, first)
+	expect.Equal([]string{"a", "b"}, second)
+}
+
+func TestBalancedClient_OtherURLsAreNotBalanced(t *testing.T) {
+	expect := assert.New(t)
+
+	var balanced, other []string
+	server1 := newEndpoint(http.StatusOK, &balanced)
+	defer server1.Close()
+	server2 := newEndpoint(http.StatusOK, &other)
+	defer server2.Close()
+
+	client, err := NewBalancedClient("test-other-urls", []string{server1.URL, "http://unused"}, RoundRobin, http.DefaultClient)
+	expect.NoError(err)
+
+	resp, err := post(client, server2.URL+"/content/suggest", "a")
+	expect.NoError(err)
+	resp.Body.Close()
+	expect.Empty(balanced)
+	expect.Equal([]string{"a"}, other)
+}
+
+func TestBalancedClient_CheckEndpoints(t *testing.T) {
+	expect := assert.New(t)
+
+	var healthy, unhealthy []string
+	server1 := newEndpoint(http.StatusOK, &healthy)
+	defer server1.Close()
+	server2 := newEndpoint(http.StatusServiceUnavailable, &unhealthy)
+	defer server2.Close()
+
+	client, err := NewBalancedClient("test-check", []string{server1.URL, server2.URL}, RoundRobin, http.DefaultClient)
+	expect.NoError(err)
+
+	suggester := NewOntotextSuggester(server1.URL, "/content/suggest/ontotext", client)
+	output, err := suggester.Check().Checker()
+	expect.NoError(err)
+	expect.Equal("Ontotext Suggestion API is healthy, 1 of 2 endpoints healthy ("+server2.URL+": Health check returned a non-200 HTTP status: 503)", output)
+
+	// the endpoint failing its health check gets no requests
+	for _, body := range []string{"a", "b"} {
+		resp, err := post(client, server1.URL+"/content/suggest", body)
+		expect.NoError(err)
+		resp.Body.Close()
+	}
+	expect.Equal([]string{"a", "b"}, healthy)
+	expect.Empty(unhealthy)
+
+	server1.Close()
+	_, err = suggester.Check().Checker()
+	expect.Error(err)
+	expect.Contains(err.Error(), "0 of 2 endpoints healthy")
+}
+
+func TestNewBalancedClient_InvalidStrategy(t *testing.T) {
+	_, err := NewBalancedClient("test-invalid", []string{"http://one"}, "random", http.DefaultClient)
+	assert.EqualError(t, err, `unknown load balancing strategy "random"`)
+}
@@ -1,18 +1,26 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	fp "path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Financial-Times/go-fthealth/v1_1"
 )
 
 type ConceptBlacklister interface {
 	IsBlacklisted(uuid string, bl Blacklist) bool
+	IsBlacklistedIn(uuid string, scope BlacklistScope, bl Blacklist) bool
 	GetBlacklist(tid string) (Blacklist, error)
+	// LastBlacklist returns the blacklist retrieved last, if any
+	LastBlacklist() (Blacklist, bool)
 	Check() v1_1.Check
 }
 
@@ -23,13 +31,77 @@ type Blacklister struct {
 	systemID      string
 	name          string
 	failureImpact string
+	inFlight      requestCollapser
+	traffic       *TrafficMonitor
+	mutex         sync.RWMutex
+	last          *Blacklist
 }
 
 type Blacklist struct {
+	// UUIDS are blacklisted wherever they are suggested
 	UUIDS []string `json:"uuids"`
+	// Entries are only blacklisted in their scope and until they expire
+	Entries []BlacklistEntry `json:"entries,omitempty"`
 }
 
-func NewConceptBlacklister(baseUrl string, endpoint string, client Client) ConceptBlacklister {
+// BlacklistEntry blacklists a concept where all its restrictions which are set match, a restriction matching when any of its values does
+type BlacklistEntry struct {
+	UUID string `json:"uuid"`
+	// Predicates restrict the entry to the suggestions with these predicates, e.g. to block a concept as about but allow it as mentions
+	Predicates []string `json:"predicates,omitempty"`
+	// Sources restrict the entry to the suggestions of the suggesters with these system ids, e.g. ontotext-suggestion-api
+	Sources []string `json:"sources,omitempty"`
+	// Types restrict the entry to the concepts of these types, e.g. http://www.ft.com/ontology/person/Person
+	Types []string `json:"types,omitempty"`
+	// Expires ends the entry, which never expires when not set
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// BlacklistScope tells where a concept is suggested, entries restricted to other predicates, sources or types not applying to it.
+// Restricted entries never apply to the attributes left empty.
+type BlacklistScope struct {
+	Predicate string
+	// Source is the system id of the suggester which suggested the concept
+	Source string
+	Type   string
+}
+
+// Version identifies the content of the blacklist, changing whenever concepts are added to it or removed from it and whenever entries expire
+func (bl Blacklist) Version() string {
+	//ignoring marshalling errors as neither UnsupportedTypeError nor UnsupportedValueError is possible
+	data, _ := json.Marshal(bl.activeAt(time.Now()))
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// activeAt returns the blacklist without the entries expired at the given time
+func (bl Blacklist) activeAt(now time.Time) Blacklist {
+	var entries []BlacklistEntry
+	for _, entry := range bl.Entries {
+		if entry.activeAt(now) {
+			entries = append(entries, entry)
+		}
+	}
+	return Blacklist{UUIDS: bl.UUIDS, Entries: entries}
+}
+
+func (e BlacklistEntry) activeAt(now time.Time) bool {
+	return e.Expires == nil || now.Before(*e.Expires)
+}
+
+func (e BlacklistEntry) appliesTo(scope BlacklistScope) bool {
+	return restrictionMatches(e.Predicates, func(predicate string) bool { return predicate == scope.Predicate }) &&
+		restrictionMatches(e.Sources, func(source string) bool { return strings.EqualFold(source, scope.Source) }) &&
+		restrictionMatches(e.Types, func(conceptType string) bool {
+			return scope.Type != "" && strings.EqualFold(fp.Base(conceptType), fp.Base(scope.Type))
+		})
+}
+
+func restrictionMatches(values []string, match func(string) bool) bool {
+	return len(values) == 0 || anyOf(values, match)
+}
+
+func NewConceptBlacklister(baseUrl string, endpoint string, client Client) *Blacklister {
 	return &Blacklister{
 		baseUrl:       baseUrl,
 		endpoint:      endpoint,
@@ -40,16 +112,54 @@ func NewConceptBlacklister(baseUrl string, endpoint string, client Client) Conce
 	}
 }
 
+// IsBlacklisted tells whether the concept is blacklisted wherever it is suggested, ignoring the entries restricted to some predicates, sources or types
 func (b *Blacklister) IsBlacklisted(conceptId string, bl Blacklist) bool {
+	return b.IsBlacklistedIn(conceptId, BlacklistScope{}, bl)
+}
+
+// IsBlacklistedIn tells whether the concept is blacklisted where it is suggested
+func (b *Blacklister) IsBlacklistedIn(conceptId string, scope BlacklistScope, bl Blacklist) bool {
 	for _, uuid := range bl.UUIDS {
 		if strings.Contains(conceptId, uuid) {
 			return true
 		}
 	}
+	now := time.Now()
+	for _, entry := range bl.Entries {
+		if entry.UUID != "" && strings.Contains(conceptId, entry.UUID) && entry.activeAt(now) && entry.appliesTo(scope) {
+			return true
+		}
+	}
 	return false
 }
 
+// GetBlacklist retrieves the current blacklist, sharing a single downstream call between concurrent callers
 func (b *Blacklister) GetBlacklist(tid string) (Blacklist, error) {
+	result, err, _ := b.inFlight.Do("blacklist", func() (interface{}, error) {
+		start := time.Now()
+		blacklist, err := b.getBlacklist(tid)
+		b.traffic.Record(time.Since(start), err != nil)
+		if err == nil {
+			b.mutex.Lock()
+			b.last = &blacklist
+			b.mutex.Unlock()
+		}
+		return blacklist, err
+	})
+	return result.(Blacklist), err
+}
+
+// LastBlacklist returns the blacklist retrieved last without calling the blacklister, false when none was retrieved yet
+func (b *Blacklister) LastBlacklist() (Blacklist, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if b.last == nil {
+		return Blacklist{}, false
+	}
+	return *b.last, true
+}
+
+func (b *Blacklister) getBlacklist(tid string) (Blacklist, error) {
 	req, err := http.NewRequest("GET", b.baseUrl+b.endpoint, nil)
 	if err != nil {
 		return Blacklist{}, err
@@ -94,23 +204,16 @@ func (b *Blacklister) Check() v1_1.Check {
 	}
 }
 
-func (b *Blacklister) healthCheck() (string, error) {
-	req, err := http.NewRequest("GET", b.baseUrl+"/__gtg", nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Add("User-Agent", "UPP public-suggestions-api")
-
-	resp, err := b.client.Do(req)
-	if err != nil {
-		return "", err
-	}
+// MonitorTraffic makes the health check report the errors and latencies of the calls made for the blacklist
+func (b *Blacklister) MonitorTraffic(monitor *TrafficMonitor) {
+	b.traffic = monitor
+}
 
-	defer resp.Body.Close()
+// DisableRequestCollapsing makes every caller fetch the blacklist itself, e.g. so that each transaction gets its own downstream call while recording
+func (b *Blacklister) DisableRequestCollapsing() {
+	b.inFlight.disabled = true
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Health check returned a non-200 HTTP status: %v", resp.StatusCode)
-	}
-	return fmt.Sprintf("%v is healthy", b.name), nil
+func (b *Blacklister) healthCheck() (string, error) {
+	return checkGTG(b.name, b.client, b.baseUrl, b.traffic)
 }
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	aboutPredicate    = "http://www.ft.com/ontology/annotation/about"
+	mentionsPredicate = "http://www.ft.com/ontology/annotation/mentions"
+)
+
+func TestBlacklister_IsBlacklistedIn(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	blacklist := Blacklist{
+		UUIDS: []string{"everywhere"},
+		Entries: []BlacklistEntry{
+			{UUID: "unscoped"},
+			{UUID: "about-only", Predicates: []string{aboutPredicate}},
+			{UUID: "ontotext-only", Sources: []string{"ontotext-suggestion-api"}},
+			{UUID: "people-only", Types: []string{ontologyPersonType}},
+			{UUID: "expired", Expires: &past},
+			{UUID: "expiring", Expires: &future},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		scope    BlacklistScope
+		expected bool
+	}{
+		{name: "legacy uuid", id: "http://www.ft.com/thing/everywhere", scope: BlacklistScope{Predicate: mentionsPredicate}, expected: true},
+		{name: "unscoped entry", id: "http://www.ft.com/thing/unscoped", scope: BlacklistScope{Predicate: mentionsPredicate}, expected: true},
+		{name: "matching predicate", id: "http://www.ft.com/thing/about-only", scope: BlacklistScope{Predicate: aboutPredicate}, expected: true},
+		{name: "other predicate", id: "http://www.ft.com/thing/about-only", scope: BlacklistScope{Predicate: mentionsPredicate}, expected: false},
+		{name: "matching source", id: "http://www.ft.com/thing/ontotext-only", scope: BlacklistScope{Source: "Ontotext-Suggestion-API"}, expected: true},
+		{name: "other source", id: "http://www.ft.com/thing/ontotext-only", scope: BlacklistScope{Source: "authors-suggestion-api"}, expected: false},
+		{name: "matching type", id: "http://www.ft.com/thing/people-only", scope: BlacklistScope{Type: ontologyPersonType}, expected: true},
+		{name: "other type", id: "http://www.ft.com/thing/people-only", scope: BlacklistScope{Type: ontologyLocationType}, expected: false},
+		{name: "no scope for a scoped entry", id: "http://www.ft.com/thing/about-only", expected: false},
+		{name: "expired entry", id: "http://www.ft.com/thing/expired", expected: false},
+		{name: "entry not expired yet", id: "http://www.ft.com/thing/expiring", expected: true},
+		{name: "not blacklisted", id: "http://www.ft.com/thing/other", expected: false},
+	}
+
+	blacklister := NewConceptBlacklister("blacklisterUrl", "/blacklist", http.DefaultClient)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, blacklister.IsBlacklistedIn(test.id, test.scope, blacklist))
+		})
+	}
+}
+
+func TestBlacklister_IsBlacklistedIgnoresScopedEntries(t *testing.T) {
+	blacklister := NewConceptBlacklister("blacklisterUrl", "/blacklist", http.DefaultClient)
+	blacklist := Blacklist{Entries: []BlacklistEntry{{UUID: "unscoped"}, {UUID: "about-only", Predicates: []string{aboutPredicate}}}}
+
+	assert.True(t, blacklister.IsBlacklisted("http://www.ft.com/thing/unscoped", blacklist))
+	assert.False(t, blacklister.IsBlacklisted("http://www.ft.com/thing/about-only", blacklist))
+}
+
+func TestBlacklister_GetScopedBlacklist(t *testing.T) {
+	expect := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"uuids": ["a"], "entries": [{"uuid": "b", "predicates": ["` + aboutPredicate + `"], "expires": "2030-01-02T15:04:05Z"}]}`))
+	}))
+	defer server.Close()
+
+	blacklist, err := NewConceptBlacklister(server.URL, "/blacklist", http.DefaultClient).GetBlacklist("tid_test")
+	expect.NoError(err)
+	expires := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	expect.Equal(Blacklist{
+		UUIDS:   []string{"a"},
+		Entries: []BlacklistEntry{{UUID: "b", Predicates: []string{aboutPredicate}, Expires: &expires}},
+	}, blacklist)
+}
+
+func TestBlacklist_VersionChangesWhenEntriesExpire(t *testing.T) {
+	expect := assert.New(t)
+
+	legacy := Blacklist{UUIDS: []string{"a"}}
+	data, _ := json.Marshal(legacy)
+	expect.JSONEq(`{"uuids": ["a"]}`, string(data))
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	expect.Equal(legacy.Version(), Blacklist{UUIDS: []string{"a"}, Entries: []BlacklistEntry{{UUID: "b", Expires: &past}}}.Version())
+	expect.NotEqual(legacy.Version(), Blacklist{UUIDS: []string{"a"}, Entries: []BlacklistEntry{{UUID: "b", Expires: &future}}}.Version())
+}
+
+func TestAggregateSuggester_GetSuggestionsWithScopedBlacklist(t *testing.T) {
+	expect := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/internalconcordances":
+			w.Write([]byte(`{"concepts": {
+				"a": {"id": "http://www.ft.com/thing/a", "prefLabel": "A", "type": "http://www.ft.com/ontology/Location"},
+				"b": {"id": "http://www.ft.com/thing/b", "prefLabel": "B", "type": "http://www.ft.com/ontology/Location"},
+				"c": {"id": "http://www.ft.com/thing/c", "prefLabel": "C", "type": "http://www.ft.com/ontology/Location"},
+				"d": {"id": "http://www.ft.com/thing/d", "prefLabel": "D", "type": "http://www.ft.com/ontology/Location"}
+			}}`))
+		case "/things":
+			w.Write([]byte(`{"things": {}}`))
+		case "/blacklist":
+			w.Write([]byte(`{"uuids": [], "entries": [
+				{"uuid": "a", "predicates": ["` + aboutPredicate + `"]},
+				{"uuid": "b", "sources": ["authors-suggestion-api"]},
+				{"uuid": "c", "sources": ["Ontotext Suggestion API"]},
+				{"uuid": "d", "sources": ["ontotext-suggestion-api"]}
+			]}`))
+		}
+	}))
+	defer server.Close()
+
+	suggestions := SuggestionsResponse{Suggestions: []Suggestion{
+		{Concept: Concept{ID: "http://www.ft.com/thing/a", Type: ontologyLocationType}, Predicate: aboutPredicate},
+		{Concept: Concept{ID: "http://www.ft.com/thing/a", Type: ontologyLocationType}, Predicate: mentionsPredicate},
+		{Concept: Concept{ID: "http://www.ft.com/thing/b", Type: ontologyLocationType}, Predicate: aboutPredicate},
+		{Concept: Concept{ID: "http://www.ft.com/thing/c", Type: ontologyLocationType}, Predicate: aboutPredicate},
+		{Concept: Concept{ID: "http://www.ft.com/thing/d", Type: ontologyLocationType}, Predicate: aboutPredicate},
+	}}
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Ontotext Suggestion API", response: suggestions})
+	defer closeServer()
+	suggester.Concordance = NewConcordance(server.URL, "/internalconcordances", http.DefaultClient)
+	suggester.BroaderProvider = NewBroaderConceptsProvider(server.URL, "/things", http.DefaultClient)
+	suggester.Blacklister = NewConceptBlacklister(server.URL, "/blacklist", http.DefaultClient)
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	var kept []string
+	for _, suggestion := range response.Suggestions {
+		kept = append(kept, suggestion.ID+" "+suggestion.Predicate)
+	}
+	// sources are matched on the system ids of the suggesters, not on their names
+	expect.Equal([]string{"http://www.ft.com/thing/a " + mentionsPredicate, "http://www.ft.com/thing/b " + aboutPredicate, "http://www.ft.com/thing/c " + aboutPredicate}, kept)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	fp "path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Financial-Times/go-fthealth/v1_1"
 )
@@ -18,6 +19,9 @@ type BroaderConceptsProvider struct {
 	PublicThingsEndpoint string
 	Client               Client
 	failureImpact        string
+	traffic              *TrafficMonitor
+	exclusion            *broaderExclusion
+	cache                *BroaderCache
 }
 
 func NewBroaderConceptsProvider(publicThingsAPIBaseURL, publicThingsEndpoint string, client Client) *BroaderConceptsProvider {
@@ -41,7 +45,8 @@ type Thing struct {
 }
 
 type BroaderConcept struct {
-	ID string `json:"id"`
+	ID        string `json:"id"`
+	Predicate string `json:"predicate,omitempty"`
 }
 
 func (b *BroaderConceptsProvider) Check() v1_1.Check {
@@ -56,28 +61,27 @@ func (b *BroaderConceptsProvider) Check() v1_1.Check {
 	}
 }
 
-func (b *BroaderConceptsProvider) healthCheck() (string, error) {
-	req, err := http.NewRequest("GET", b.PublicThingsBaseURL+"/__gtg", nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Add("User-Agent", "UPP public-suggestions-api")
-
-	resp, err := b.Client.Do(req)
-	if err != nil {
-		return "", err
-	}
+// MonitorTraffic makes the health check report the errors and latencies of the calls made for broader concepts
+func (b *BroaderConceptsProvider) MonitorTraffic(monitor *TrafficMonitor) {
+	b.traffic = monitor
+}
 
-	defer resp.Body.Close()
+// CacheBroaderConcepts makes the provider keep the broader concepts it fetched in the given cache
+func (b *BroaderConceptsProvider) CacheBroaderConcepts(cache *BroaderCache) {
+	b.cache = cache
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Health check returned a non-200 HTTP status: %v", resp.StatusCode)
+func (b *BroaderConceptsProvider) healthCheck() (string, error) {
+	output, err := checkGTG(b.name, b.Client, b.PublicThingsBaseURL, b.traffic)
+	if err != nil || b.cache == nil {
+		return output, err
 	}
-	return fmt.Sprintf("%v is healthy", b.name), nil
+	return output + ", " + b.cache.summary(), nil
 }
 
-func (b *BroaderConceptsProvider) excludeBroaderConceptsFromResponse(suggestions map[int][]Suggestion, tid string) (map[int][]Suggestion, error) {
+// lookupBroaderConcepts retrieves the broader concepts of the given suggestions, which can be looked up before their concordances
+// since public things resolves the concepts to their canonical concept
+func (b *BroaderConceptsProvider) lookupBroaderConcepts(suggestions map[int][]Suggestion, tid string) (*broaderResponse, error) {
 	var ids []string
 	for _, sourceSuggestions := range suggestions {
 		for _, suggestion := range sourceSuggestions {
@@ -86,29 +90,87 @@ func (b *BroaderConceptsProvider) excludeBroaderConceptsFromResponse(suggestions
 	}
 
 	if len(ids) == 0 {
-		return suggestions, nil
+		return &broaderResponse{}, nil
 	}
-
-	results := make(map[int][]Suggestion)
 	broader, err := b.getBroaderConcepts(ids, tid)
 	if err != nil {
-		return suggestions, err
+		return nil, err
+	}
+	return b.lookupIntermediateConcepts(ids, broader, tid)
+}
+
+// lookupIntermediateConcepts adds the broader concepts of the concepts between the suggestions and their transitive broader concepts,
+// level by level up to the max depth of the exclusion rules, so that the depths are known even through concepts which were not suggested
+func (b *BroaderConceptsProvider) lookupIntermediateConcepts(ids []string, broader *broaderResponse, tid string) (*broaderResponse, error) {
+	// without a max depth, all the broader concepts are excluded whatever their depth
+	if b.exclusion == nil || b.exclusion.maxDepth <= 1 {
+		return broader, nil
 	}
 
-	broaderConceptsChecker := make(map[string]bool)
-	for _, thing := range broader.Things {
-		for _, broaderConcept := range thing.BroaderConcepts {
-			broaderConceptsChecker[fp.Base(broaderConcept.ID)] = true
+	hierarchy := &broaderResponse{Things: make(map[string]Thing, len(broader.Things))}
+	looked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		looked[id] = true
+	}
+	level := broader.Things
+	for depth := 1; depth < b.exclusion.maxDepth && len(level) > 0; depth++ {
+		var missing []string
+		for id, thing := range level {
+			hierarchy.Things[id] = thing
+			looked[canonicalID(id, thing)] = true
+		}
+		for _, thing := range level {
+			for _, parent := range directBroaderIDs(thing) {
+				if !looked[parent] {
+					looked[parent] = true
+					missing = append(missing, parent)
+				}
+			}
+		}
+		if len(missing) == 0 {
+			return hierarchy, nil
+		}
+		next, err := b.getBroaderConcepts(missing, tid)
+		if err != nil {
+			return nil, err
+		}
+		level = next.Things
+	}
+	for id, thing := range level {
+		hierarchy.Things[id] = thing
+	}
+	return hierarchy, nil
+}
+
+// excludeBroaderConcepts drops the suggestions which are broader concepts of the other suggestions, according to the exclusion rules
+func (b *BroaderConceptsProvider) excludeBroaderConcepts(suggestions map[int][]Suggestion, broader *broaderResponse) map[int][]Suggestion {
+	// only the remaining suggestions exclude their broader concepts
+	suggested := make(map[string]bool)
+	for _, sourceSuggestions := range suggestions {
+		for _, suggestion := range sourceSuggestions {
+			suggested[fp.Base(suggestion.ID)] = true
+		}
+	}
+	narrower := &broaderResponse{Things: make(map[string]Thing)}
+	hierarchy := make(map[string][]string, len(broader.Things))
+	for id, thing := range broader.Things {
+		id = canonicalID(id, thing)
+		hierarchy[id] = append(hierarchy[id], directBroaderIDs(thing)...)
+		if suggested[id] {
+			narrower.Things[id] = thing
 		}
 	}
-	if len(broaderConceptsChecker) == 0 {
-		return suggestions, nil
+
+	broaderConceptsDepths := broaderDepths(narrower, hierarchy)
+	if len(broaderConceptsDepths) == 0 {
+		return suggestions
 	}
 
+	results := make(map[int][]Suggestion)
 	for mapIdx, sourceSuggestions := range suggestions {
 		filteredSourceSuggestions := []Suggestion{}
 		for _, suggestion := range sourceSuggestions {
-			if broaderConceptsChecker[fp.Base(suggestion.ID)] {
+			if depth, found := broaderConceptsDepths[fp.Base(suggestion.ID)]; found && b.exclusion.excludes(suggestion, depth) {
 				continue
 			}
 			filteredSourceSuggestions = append(filteredSourceSuggestions, suggestion)
@@ -116,10 +178,38 @@ func (b *BroaderConceptsProvider) excludeBroaderConceptsFromResponse(suggestions
 		results[mapIdx] = filteredSourceSuggestions
 	}
 
-	return results, nil
+	return results
 }
 
+// getBroaderConcepts retrieves the broader concepts of the given concept IDs, only fetching the ones which are not cached
 func (b *BroaderConceptsProvider) getBroaderConcepts(ids []string, tid string) (*broaderResponse, error) {
+	if b.cache == nil {
+		return b.fetchWithTraffic(ids, tid)
+	}
+
+	result, missing := b.cache.get(ids)
+	if len(missing) == 0 {
+		return result, nil
+	}
+	fetched, err := b.fetchWithTraffic(missing, tid)
+	if err != nil {
+		return nil, err
+	}
+	b.cache.set(missing, fetched)
+	for id, thing := range fetched.Things {
+		result.Things[id] = thing
+	}
+	return result, nil
+}
+
+func (b *BroaderConceptsProvider) fetchWithTraffic(ids []string, tid string) (*broaderResponse, error) {
+	start := time.Now()
+	result, err := b.fetchBroaderConcepts(ids, tid)
+	b.traffic.Record(time.Since(start), err != nil)
+	return result, err
+}
+
+func (b *BroaderConceptsProvider) fetchBroaderConcepts(ids []string, tid string) (*broaderResponse, error) {
 	var result broaderResponse
 	preparedURL := fmt.Sprintf("%s/%s", strings.TrimRight(b.PublicThingsBaseURL, "/"), strings.Trim(b.PublicThingsEndpoint, "/"))
 	req, err := http.NewRequest("GET", preparedURL, nil)
@@ -7,13 +7,32 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+// runBroaderExclusion runs the suggestions through the broader exclusion stage, returning the error of the lookup of the broader concepts
+// which the stage only logs, marking the request as incomplete and keeping the suggestions
+func runBroaderExclusion(provider *BroaderConceptsProvider, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	request := newProcessingRequest()
+	res, err := Pipeline{&BroaderExclusionProcessor{Provider: provider}}.Run(request, suggestions)
+	if err != nil {
+		return res, err
+	}
+	if lookupErr := request.prefetches[0].err; lookupErr != nil {
+		if !request.incomplete {
+			return res, errors.New("request not marked as incomplete after the broader concepts lookup failed")
+		}
+		return res, lookupErr
+	}
+	return res, nil
+}
+
 func TestBroaderConceptsProvider_CheckHealth(t *testing.T) {
 	expect := assert.New(t)
 	mockServer := new(mockSuggestionApiServer)
@@ -534,7 +553,7 @@ func TestBroaderService_excludeBroaderConcepts(t *testing.T) {
 
 		excludeService := NewBroaderConceptsProvider("dummyURL", "things", publicThingsMock)
 
-		res, err := excludeService.excludeBroaderConceptsFromResponse(testCase.suggestions, "test_tid")
+		res, err := runBroaderExclusion(excludeService, testCase.suggestions)
 		if err != nil {
 			ast.NotEmptyf(testCase.expectedErrorContains, "%s -> empty expected error", testCase.testName)
 			ast.Containsf(err.Error(), testCase.expectedErrorContains, "%s -> not expected error returned", testCase.testName)
@@ -561,3 +580,212 @@ func TestBroaderService_excludeBroaderConcepts(t *testing.T) {
 		publicThingsMock.AssertExpectations(t)
 	}
 }
+
+func TestBroaderService_excludeBroaderConceptsOfConcordedSources(t *testing.T) {
+	expect := assert.New(t)
+
+	// the broader concepts were looked up with the source IDs, which public things resolves to other canonical concepts
+	broader := &broaderResponse{Things: map[string]Thing{
+		"paris-source":  {ID: "http://www.ft.com/thing/paris", BroaderConcepts: []BroaderConcept{{ID: "http://www.ft.com/thing/france"}}},
+		"london-source": {ID: "http://www.ft.com/thing/london", BroaderConcepts: []BroaderConcept{{ID: "http://www.ft.com/thing/uk"}}},
+	}}
+	// the suggestions were concorded to their canonical concepts meanwhile, London being dropped
+	suggestions := map[int][]Suggestion{
+		0: {
+			{Concept: Concept{ID: "http://www.ft.com/thing/paris", Type: ontologyLocationType}},
+			{Concept: Concept{ID: "http://www.ft.com/thing/france", Type: ontologyLocationType}},
+			{Concept: Concept{ID: "http://www.ft.com/thing/uk", Type: ontologyLocationType}},
+		},
+	}
+
+	provider := NewBroaderConceptsProvider("publicThingsUrl", "/things", http.DefaultClient)
+	excluded := provider.excludeBroaderConcepts(suggestions, broader)
+
+	var ids []string
+	for _, suggestion := range excluded[0] {
+		ids = append(ids, suggestion.ID)
+	}
+	// France is excluded by the canonical concept of its narrower source, the UK is kept as London is not suggested
+	expect.Equal([]string{"http://www.ft.com/thing/paris", "http://www.ft.com/thing/uk"}, ids)
+}
+
+func TestBroaderService_excludeBroaderConceptsWithRules(t *testing.T) {
+	ast := assert.New(t)
+
+	const (
+		france        = "d0a7e83c-fbad-4e13-9a1c-2c5e0b0c3f01"
+		westernEurope = "5e2c7a4d-9b3f-4c4e-8d6a-1f0e2b3c4d02"
+		europe        = "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c03"
+		inflation     = "7c6b5a49-3827-4160-9f5e-4d3c2b1a0f04"
+		economics     = "0f1e2d3c-4b5a-4968-8776-655443322105"
+	)
+	thing := func(id string, broader ...BroaderConcept) Thing {
+		return Thing{ID: "http://www.ft.com/thing/" + id, BroaderConcepts: broader}
+	}
+	direct := func(id string) BroaderConcept {
+		return BroaderConcept{ID: "http://www.ft.com/thing/" + id, Predicate: "http://www.w3.org/2004/02/skos/core#broader"}
+	}
+	transitive := func(id string) BroaderConcept {
+		return BroaderConcept{ID: "http://www.ft.com/thing/" + id, Predicate: predicateBroaderTransitive}
+	}
+	suggestion := func(id string, conceptType string) Suggestion {
+		return Suggestion{Concept: Concept{ID: "http://www.ft.com/thing/" + id, Type: conceptType}}
+	}
+
+	testCases := []struct {
+		testName    string
+		rules       *BroaderExclusionRules
+		withWestern bool
+		expectedIDs []string
+	}{
+		{
+			testName:    "noRules",
+			expectedIDs: []string{france, inflation},
+		},
+		{
+			testName:    "maxDepth_transitiveThroughUnsuggestedConcept",
+			rules:       &BroaderExclusionRules{MaxDepth: 1},
+			expectedIDs: []string{france, europe, inflation},
+		},
+		{
+			testName:    "maxDepth_transitiveThroughSuggestedConcept",
+			rules:       &BroaderExclusionRules{MaxDepth: 1},
+			withWestern: true,
+			expectedIDs: []string{france, inflation},
+		},
+		{
+			testName:    "disabledTypes",
+			rules:       &BroaderExclusionRules{DisabledTypes: []string{LocationSourceParam}},
+			expectedIDs: []string{france, europe, inflation},
+		},
+		{
+			testName:    "enabledTypes",
+			rules:       &BroaderExclusionRules{EnabledTypes: []string{LocationSourceParam}},
+			expectedIDs: []string{france, inflation, economics},
+		},
+		{
+			testName:    "whitelist",
+			rules:       &BroaderExclusionRules{Whitelist: []string{"http://www.ft.com/thing/" + europe}},
+			expectedIDs: []string{france, europe, inflation},
+		},
+	}
+
+	for _, testCase := range testCases {
+		response := broaderResponse{Things: map[string]Thing{
+			france:    thing(france, direct(westernEurope), transitive(europe)),
+			inflation: thing(inflation, direct(economics)),
+		}}
+		suggestions := []Suggestion{
+			suggestion(france, ontologyLocationType),
+			suggestion(europe, ontologyLocationType),
+			suggestion(inflation, ontologyTopicType),
+			suggestion(economics, ontologyTopicType),
+		}
+		if testCase.withWestern {
+			response.Things[westernEurope] = thing(westernEurope, direct(europe))
+			suggestions = append(suggestions, suggestion(westernEurope, ontologyLocationType))
+		}
+		responseBytes, err := json.Marshal(response)
+		ast.NoError(err)
+
+		publicThingsMock := new(mockHttpClient)
+		publicThingsMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader(responseBytes)),
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+
+		excludeService := NewBroaderConceptsProvider("dummyURL", "things", publicThingsMock)
+		if testCase.rules != nil {
+			ast.NoErrorf(excludeService.SetExclusionRules(*testCase.rules), "%s -> unexpected rules error", testCase.testName)
+		}
+
+		res, err := runBroaderExclusion(excludeService, map[int][]Suggestion{0: suggestions})
+		ast.NoErrorf(err, "%s -> unexpected error during excluding broader concepts", testCase.testName)
+
+		var ids []string
+		for _, actualSuggestion := range res[0] {
+			ids = append(ids, actualSuggestion.ID[len("http://www.ft.com/thing/"):])
+		}
+		ast.Equalf(testCase.expectedIDs, ids, "%s -> unexpected results", testCase.testName)
+		publicThingsMock.AssertExpectations(t)
+	}
+}
+
+func TestBroaderService_excludeBroaderConceptsThroughUnsuggestedConcepts(t *testing.T) {
+	expect := assert.New(t)
+
+	hierarchy := map[string]Thing{
+		"france": {ID: "http://www.ft.com/thing/france", BroaderConcepts: []BroaderConcept{
+			{ID: "http://www.ft.com/thing/western-europe"},
+			{ID: "http://www.ft.com/thing/europe", Predicate: predicateBroaderTransitive},
+			{ID: "http://www.ft.com/thing/world", Predicate: predicateBroaderTransitive},
+		}},
+		"western-europe": {ID: "http://www.ft.com/thing/western-europe", BroaderConcepts: []BroaderConcept{
+			{ID: "http://www.ft.com/thing/europe"},
+			{ID: "http://www.ft.com/thing/world", Predicate: predicateBroaderTransitive},
+		}},
+		"europe": {ID: "http://www.ft.com/thing/europe", BroaderConcepts: []BroaderConcept{{ID: "http://www.ft.com/thing/world"}}},
+	}
+
+	testCases := []struct {
+		testName          string
+		maxDepth          int
+		expectedIDs       []string
+		expectedRequested [][]string
+	}{
+		{
+			testName:          "intermediateConceptLookedUp",
+			maxDepth:          2,
+			expectedIDs:       []string{"http://www.ft.com/thing/france"},
+			expectedRequested: [][]string{{"europe", "france"}, {"western-europe", "world"}},
+		},
+		{
+			testName:          "beyondMaxDepth",
+			maxDepth:          1,
+			expectedIDs:       []string{"http://www.ft.com/thing/france", "http://www.ft.com/thing/europe"},
+			expectedRequested: [][]string{{"europe", "france"}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		var requested [][]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uuids := r.URL.Query()["uuid"]
+			sort.Strings(uuids)
+			requested = append(requested, uuids)
+			response := broaderResponse{Things: map[string]Thing{}}
+			for _, id := range uuids {
+				if thing, found := hierarchy[id]; found {
+					response.Things[id] = thing
+				}
+			}
+			json.NewEncoder(w).Encode(response)
+		}))
+
+		provider := NewBroaderConceptsProvider(server.URL, "/things", http.DefaultClient)
+		expect.NoError(provider.SetExclusionRules(BroaderExclusionRules{MaxDepth: testCase.maxDepth}))
+		suggestions := map[int][]Suggestion{0: {
+			{Concept: Concept{ID: "http://www.ft.com/thing/france", Type: ontologyLocationType}},
+			{Concept: Concept{ID: "http://www.ft.com/thing/europe", Type: ontologyLocationType}},
+		}}
+
+		res, err := runBroaderExclusion(provider, suggestions)
+		server.Close()
+		expect.NoError(err, testCase.testName)
+
+		var ids []string
+		for _, suggestion := range res[0] {
+			ids = append(ids, suggestion.ID)
+		}
+		expect.Equal(testCase.expectedIDs, ids, testCase.testName)
+		expect.Equal(testCase.expectedRequested, requested, testCase.testName)
+	}
+}
+
+func TestBroaderService_SetExclusionRulesInvalid(t *testing.T) {
+	ast := assert.New(t)
+
+	excludeService := NewBroaderConceptsProvider("dummyURL", "things", http.DefaultClient)
+	ast.EqualError(excludeService.SetExclusionRules(BroaderExclusionRules{DisabledTypes: []string{"planetSource"}}), `unknown concept type "planetSource"`)
+	ast.EqualError(excludeService.SetExclusionRules(BroaderExclusionRules{MaxDepth: -1}), "invalid max depth -1")
+}
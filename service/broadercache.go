@@ -0,0 +1,152 @@
+package service
+
+import (
+	"container/list"
+	"fmt"
+	fp "path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// BroaderCache keeps the broader concepts of each concept ID, so that only unknown IDs are fetched from public things.
+// Concepts without broader concepts are cached too, for the negative TTL which is usually shorter.
+// Entries expire after their TTL and the least recently used entries are evicted when the cache is full.
+type BroaderCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+	mutex       sync.Mutex
+	entries     map[string]*list.Element
+	lru         *list.List
+	now         func() time.Time
+	stats       BroaderCacheStats
+	hits        metrics.Counter
+	misses      metrics.Counter
+	evictions   metrics.Counter
+}
+
+type BroaderCacheStats struct {
+	Entries         int
+	NegativeEntries int
+	Hits            int64
+	Misses          int64
+	Evictions       int64
+}
+
+type broaderCacheEntry struct {
+	id      string
+	thing   Thing
+	expires time.Time
+}
+
+func NewBroaderCache(ttl time.Duration, negativeTTL time.Duration, maxEntries int) *BroaderCache {
+	return &BroaderCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		maxEntries:  maxEntries,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		now:         time.Now,
+		hits:        metrics.GetOrRegisterCounter("broader.cache.hits", metrics.DefaultRegistry),
+		misses:      metrics.GetOrRegisterCounter("broader.cache.misses", metrics.DefaultRegistry),
+		evictions:   metrics.GetOrRegisterCounter("broader.cache.evictions", metrics.DefaultRegistry),
+	}
+}
+
+// get returns the cached things with broader concepts, and the IDs which are not cached
+func (c *BroaderCache) get(ids []string) (*broaderResponse, []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cached := &broaderResponse{Things: make(map[string]Thing)}
+	var missing []string
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		id = fp.Base(id)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		element, ok := c.entries[id]
+		if ok && c.now().After(element.Value.(*broaderCacheEntry).expires) {
+			c.removeElement(element)
+			ok = false
+		}
+		if !ok {
+			missing = append(missing, id)
+			c.stats.Misses++
+			c.misses.Inc(1)
+			continue
+		}
+
+		c.lru.MoveToFront(element)
+		c.stats.Hits++
+		c.hits.Inc(1)
+		if entry := element.Value.(*broaderCacheEntry); len(entry.thing.BroaderConcepts) > 0 {
+			cached.Things[id] = entry.thing
+		}
+	}
+	return cached, missing
+}
+
+// set caches the things fetched for the given IDs, the IDs without broader concepts being cached as such
+func (c *BroaderCache) set(ids []string, fetched *broaderResponse) {
+	things := make(map[string]Thing, len(fetched.Things))
+	for id, thing := range fetched.Things {
+		things[fp.Base(id)] = thing
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, id := range ids {
+		if element, ok := c.entries[id]; ok {
+			c.removeElement(element)
+		}
+		entry := &broaderCacheEntry{id: id, thing: things[id], expires: c.now().Add(c.ttl)}
+		if len(entry.thing.BroaderConcepts) == 0 {
+			entry.expires = c.now().Add(c.negativeTTL)
+		}
+		c.entries[id] = c.lru.PushFront(entry)
+	}
+
+	for c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+		c.stats.Evictions++
+		c.evictions.Inc(1)
+	}
+}
+
+// Stats returns the cache statistics since its creation, entries including the expired ones not evicted yet
+func (c *BroaderCache) Stats() BroaderCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	for element := c.lru.Front(); element != nil; element = element.Next() {
+		if len(element.Value.(*broaderCacheEntry).thing.BroaderConcepts) == 0 {
+			stats.NegativeEntries++
+		}
+	}
+	return stats
+}
+
+// summary describes the cache statistics for the health check output
+func (c *BroaderCache) summary() string {
+	stats := c.Stats()
+	hitRate := 0.0
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		hitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return fmt.Sprintf("broader cache: %d entries (%d without broader concepts), %.1f%% hits, %d evictions",
+		stats.Entries, stats.NegativeEntries, hitRate*100, stats.Evictions)
+}
+
+func (c *BroaderCache) removeElement(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*broaderCacheEntry).id)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newThingsServer serves the broader concepts of france only, recording the UUIDs requested
+func newThingsServer(requested *[][]string) *httptest.Server {
+	var mutex sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/__gtg" {
+			return
+		}
+		uuids := r.URL.Query()["uuid"]
+		sort.Strings(uuids)
+		mutex.Lock()
+		*requested = append(*requested, uuids)
+		mutex.Unlock()
+
+		response := broaderResponse{Things: map[string]Thing{}}
+		for _, id := range uuids {
+			if id == "france" {
+				response.Things[id] = Thing{ID: "http://www.ft.com/thing/france", BroaderConcepts: []BroaderConcept{{ID: "http://www.ft.com/thing/europe"}}}
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestBroaderConceptsProvider_CachedBroaderConceptsAreNotFetched(t *testing.T) {
+	expect := assert.New(t)
+
+	var requested [][]string
+	server := newThingsServer(&requested)
+	defer server.Close()
+
+	provider := NewBroaderConceptsProvider(server.URL, "/things", http.DefaultClient)
+	cache := NewBroaderCache(time.Hour, time.Minute, 10)
+	provider.CacheBroaderConcepts(cache)
+
+	result, err := provider.getBroaderConcepts([]string{"france", "inflation"}, "tid_test")
+	expect.NoError(err)
+	expect.Len(result.Things, 1)
+
+	result, err = provider.getBroaderConcepts([]string{"france", "inflation", "paris"}, "tid_test")
+	expect.NoError(err)
+	expect.Equal([]BroaderConcept{{ID: "http://www.ft.com/thing/europe"}}, result.Things["france"].BroaderConcepts)
+	expect.Len(result.Things, 1)
+
+	// inflation has no broader concepts, which is cached too
+	_, err = provider.getBroaderConcepts([]string{"inflation", "france"}, "tid_test")
+	expect.NoError(err)
+
+	expect.Equal([][]string{{"france", "inflation"}, {"paris"}}, requested)
+	expect.Equal(BroaderCacheStats{Entries: 3, NegativeEntries: 2, Hits: 4, Misses: 3}, cache.Stats())
+}
+
+func TestBroaderCache_NegativeEntriesExpireFirst(t *testing.T) {
+	expect := assert.New(t)
+
+	cache := NewBroaderCache(time.Hour, time.Minute, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	cache.set([]string{"france", "inflation"}, &broaderResponse{Things: map[string]Thing{
+		"france": {BroaderConcepts: []BroaderConcept{{ID: "http://www.ft.com/thing/europe"}}},
+	}})
+
+	now = now.Add(2 * time.Minute)
+	cached, missing := cache.get([]string{"france", "inflation"})
+	expect.Len(cached.Things, 1)
+	expect.Equal([]string{"inflation"}, missing)
+
+	now = now.Add(time.Hour)
+	cached, missing = cache.get([]string{"france"})
+	expect.Empty(cached.Things)
+	expect.Equal([]string{"france"}, missing)
+}
+
+func TestBroaderCache_LeastRecentlyUsedEntriesAreEvicted(t *testing.T) {
+	expect := assert.New(t)
+
+	cache := NewBroaderCache(time.Hour, time.Hour, 2)
+	cache.set([]string{"first", "second"}, &broaderResponse{})
+	cache.get([]string{"first"})
+	cache.set([]string{"third"}, &broaderResponse{})
+
+	_, missing := cache.get([]string{"first", "second", "third"})
+	expect.Equal([]string{"second"}, missing)
+	expect.Equal(int64(1), cache.Stats().Evictions)
+	expect.Equal(2, cache.Stats().Entries)
+}
+
+func TestBroaderConceptsProvider_CheckHealthReportsCache(t *testing.T) {
+	expect := assert.New(t)
+
+	var requested [][]string
+	server := newThingsServer(&requested)
+	defer server.Close()
+
+	provider := NewBroaderConceptsProvider(server.URL, "/things", http.DefaultClient)
+	provider.CacheBroaderConcepts(NewBroaderCache(time.Hour, time.Minute, 10))
+	provider.getBroaderConcepts([]string{"france"}, "tid_test")
+	provider.getBroaderConcepts([]string{"france"}, "tid_test")
+
+	output, err := provider.Check().Checker()
+	expect.NoError(err)
+	expect.Equal("public-things-api is healthy, broader cache: 1 entries (0 without broader concepts), 50.0% hits, 0 evictions", output)
+}
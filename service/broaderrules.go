@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	fp "path/filepath"
+)
+
+const (
+	predicateBroaderTransitive = "http://www.w3.org/2004/02/skos/core#broaderTransitive"
+
+	unknownDepth = math.MaxInt32
+)
+
+// BroaderExclusionRules restrict which broader concepts of other suggestions are excluded from the response.
+// The zero value excludes all of them, whatever their type or distance to the narrower suggestions.
+type BroaderExclusionRules struct {
+	// MaxDepth is the maximum distance in the hierarchy between an excluded concept and a narrower suggestion, 0 meaning no limit.
+	// Direct broader concepts are at depth 1.
+	MaxDepth int
+	// EnabledTypes limits the exclusion to the suggestions of these concept types when not empty
+	EnabledTypes []string
+	// DisabledTypes are the concept types of the suggestions never excluded
+	DisabledTypes []string
+	// Whitelist has the UUIDs of the concepts never excluded
+	Whitelist []string
+}
+
+type broaderExclusion struct {
+	maxDepth      int
+	enabledTypes  []string
+	disabledTypes []string
+	whitelist     map[string]bool
+}
+
+// SetExclusionRules changes which broader concepts are excluded from the response.
+// The concept types are PseudoConceptTypeAuthor and the source params, like for the concept types targeted by the suggesters.
+func (b *BroaderConceptsProvider) SetExclusionRules(rules BroaderExclusionRules) error {
+	for _, conceptType := range append(append([]string{}, rules.EnabledTypes...), rules.DisabledTypes...) {
+		if _, found := typeValidators[conceptType]; !found {
+			return fmt.Errorf("unknown concept type %q", conceptType)
+		}
+	}
+	if rules.MaxDepth < 0 {
+		return fmt.Errorf("invalid max depth %d", rules.MaxDepth)
+	}
+
+	exclusion := &broaderExclusion{
+		maxDepth:      rules.MaxDepth,
+		enabledTypes:  rules.EnabledTypes,
+		disabledTypes: rules.DisabledTypes,
+		whitelist:     make(map[string]bool, len(rules.Whitelist)),
+	}
+	for _, id := range rules.Whitelist {
+		exclusion.whitelist[fp.Base(id)] = true
+	}
+	b.exclusion = exclusion
+	return nil
+}
+
+// excludes tells whether a suggestion found at the given depth above another suggestion is excluded, all of them being excluded without rules
+func (e *broaderExclusion) excludes(suggestion Suggestion, depth int) bool {
+	if e == nil {
+		return true
+	}
+	if e.maxDepth > 0 && depth > e.maxDepth {
+		return false
+	}
+	if e.whitelist[fp.Base(suggestion.ID)] {
+		return false
+	}
+	if len(e.enabledTypes) > 0 && len(filterByConceptTypes([]Suggestion{suggestion}, e.enabledTypes)) == 0 {
+		return false
+	}
+	return len(filterByConceptTypes([]Suggestion{suggestion}, e.disabledTypes)) == 0
+}
+
+// broaderDepths maps the broader concepts of the suggestions to their smallest distance to a narrower suggestion.
+// The distance is measured through the direct broader concepts of the given hierarchy,
+// so transitive broader concepts only related through concepts missing from it have an unknown depth.
+func broaderDepths(broader *broaderResponse, direct map[string][]string) map[string]int {
+	depths := make(map[string]int)
+	for id, thing := range broader.Things {
+		narrower := fp.Base(id)
+		reached := map[string]int{narrower: 0}
+		queue := []string{narrower}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, parent := range direct[current] {
+				if _, found := reached[parent]; !found {
+					reached[parent] = reached[current] + 1
+					queue = append(queue, parent)
+				}
+			}
+		}
+
+		for _, broaderConcept := range thing.BroaderConcepts {
+			broaderID := fp.Base(broaderConcept.ID)
+			if broaderID == narrower {
+				continue
+			}
+			depth, found := reached[broaderID]
+			if !found {
+				depth = unknownDepth
+			}
+			if known, found := depths[broaderID]; !found || depth < known {
+				depths[broaderID] = depth
+			}
+		}
+	}
+	return depths
+}
+
+// directBroaderIDs returns the UUIDs of the direct broader concepts of a concept
+func directBroaderIDs(thing Thing) []string {
+	var ids []string
+	for _, broaderConcept := range thing.BroaderConcepts {
+		if broaderConcept.Predicate != predicateBroaderTransitive {
+			ids = append(ids, fp.Base(broaderConcept.ID))
+		}
+	}
+	return ids
+}
+
+// canonicalID returns the UUID of the canonical concept public things resolved the looked up ID to
+func canonicalID(id string, thing Thing) string {
+	if thing.ID != "" {
+		return fp.Base(thing.ID)
+	}
+	return fp.Base(id)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// ResponseCache keeps aggregated suggestion responses for identical requests, so that they can be answered without calling the downstream services.
+// Entries expire after the configured TTL, the least recently used entries are evicted when the cache is full,
+// and all the entries are invalidated when the blacklist version changes.
+type ResponseCache struct {
+	ttl              time.Duration
+	maxEntries       int
+	mutex            sync.Mutex
+	blacklistVersion string
+	entries          map[string]*list.Element
+	lru              *list.List
+	now              func() time.Time
+	hits             metrics.Counter
+	misses           metrics.Counter
+}
+
+type cacheEntry struct {
+	key      string
+	response SuggestionsResponse
+	expires  time.Time
+}
+
+func NewResponseCache(ttl time.Duration, maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+		hits:       metrics.GetOrRegisterCounter("suggest.cache.hits", metrics.DefaultRegistry),
+		misses:     metrics.GetOrRegisterCounter("suggest.cache.misses", metrics.DefaultRegistry),
+	}
+}
+
+// CacheKey hashes the transformed payload together with the request options that influence the response.
+func CacheKey(payload []byte, options ...string) string {
+	hash := sha256.New()
+	hash.Write(payload)
+	for _, option := range options {
+		hash.Write([]byte{0})
+		hash.Write([]byte(option))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *ResponseCache) Get(key string, blacklistVersion string) (SuggestionsResponse, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checkBlacklistVersion(blacklistVersion)
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses.Inc(1)
+		return SuggestionsResponse{}, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.removeElement(element)
+		c.misses.Inc(1)
+		return SuggestionsResponse{}, false
+	}
+
+	c.lru.MoveToFront(element)
+	c.hits.Inc(1)
+	return copySuggestionsResponse(entry.response), true
+}
+
+func (c *ResponseCache) Set(key string, blacklistVersion string, response SuggestionsResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checkBlacklistVersion(blacklistVersion)
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:      key,
+		response: copySuggestionsResponse(response),
+		expires:  c.now().Add(c.ttl),
+	})
+
+	for c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// Len returns the number of cached responses, including expired ones not evicted yet
+func (c *ResponseCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// checkBlacklistVersion drops all the cached responses when they were filtered using another blacklist version
+func (c *ResponseCache) checkBlacklistVersion(blacklistVersion string) {
+	if c.blacklistVersion == blacklistVersion {
+		return
+	}
+	c.blacklistVersion = blacklistVersion
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *ResponseCache) removeElement(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+func copySuggestionsResponse(response SuggestionsResponse) SuggestionsResponse {
+	suggestions := make([]Suggestion, len(response.Suggestions))
+	copy(suggestions, response.Suggestions)
+	return SuggestionsResponse{Suggestions: suggestions, Variant: response.Variant}
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestResponseCache_GetSet(t *testing.T) {
+	expect := assert.New(t)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewResponseCache(time.Minute, 2)
+	cache.now = func() time.Time { return now }
+
+	response := SuggestionsResponse{Suggestions: []Suggestion{{Concept: Concept{ID: "http://www.ft.com/thing/f758ef56-c40a-3162-91aa-3e8a3aabc495"}}}}
+	key := CacheKey([]byte(`{"bodyXML":"London"}`))
+
+	_, found := cache.Get(key, "v1")
+	expect.False(found)
+
+	cache.Set(key, "v1", response)
+	cached, found := cache.Get(key, "v1")
+	expect.True(found)
+	expect.Equal(response, cached)
+
+	// cached responses are not affected by changes of the returned ones
+	cached.Suggestions[0].ID = "changed"
+	cached, _ = cache.Get(key, "v1")
+	expect.Equal(response, cached)
+
+	now = now.Add(2 * time.Minute)
+	_, found = cache.Get(key, "v1")
+	expect.False(found)
+	expect.Equal(0, cache.Len())
+}
+
+func TestResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	expect := assert.New(t)
+
+	cache := NewResponseCache(time.Minute, 2)
+	cache.Set("first", "v1", SuggestionsResponse{})
+	cache.Set("second", "v1", SuggestionsResponse{})
+	_, found := cache.Get("first", "v1")
+	expect.True(found)
+
+	cache.Set("third", "v1", SuggestionsResponse{})
+
+	expect.Equal(2, cache.Len())
+	_, found = cache.Get("second", "v1")
+	expect.False(found)
+	_, found = cache.Get("first", "v1")
+	expect.True(found)
+	_, found = cache.Get("third", "v1")
+	expect.True(found)
+}
+
+func TestResponseCache_InvalidatedByBlacklistVersion(t *testing.T) {
+	expect := assert.New(t)
+
+	cache := NewResponseCache(time.Minute, 10)
+	cache.Set("first", "v1", SuggestionsResponse{})
+	cache.Set("second", "v1", SuggestionsResponse{})
+
+	_, found := cache.Get("first", "v2")
+	expect.False(found)
+	expect.Equal(0, cache.Len())
+}
+
+func TestCacheKey(t *testing.T) {
+	expect := assert.New(t)
+
+	expect.Equal(CacheKey([]byte("payload")), CacheKey([]byte("payload")))
+	expect.NotEqual(CacheKey([]byte("payload")), CacheKey([]byte("another payload")))
+	expect.NotEqual(CacheKey([]byte("payload")), CacheKey([]byte("payload"), "option"))
+	expect.NotEqual(CacheKey([]byte("payload"), "ab"), CacheKey([]byte("payload"), "a", "b"))
+}
+
+func TestAggregateSuggester_GetSuggestionsFromCache(t *testing.T) {
+	expect := assert.New(t)
+
+	suggestionApi := new(mockSuggestionApi)
+	log := logger.NewUPPLogger("test-service", "panic")
+	mockClient := new(mockHttpClient)
+	mockConcordance := NewConcordance("internalConcordancesHost", "/internalconcordances", mockClient)
+
+	ontotextSuggestion := SuggestionsResponse{Suggestions: []Suggestion{
+		{Predicate: "predicate", Concept: Concept{ID: "ontotext-suggestion-api", APIURL: "apiurl1", PrefLabel: "prefLabel1", Type: ontologyPersonType}},
+	}}
+	suggestionApi.On("GetSuggestions", mock.AnythingOfType("[]uint8"), "tid_test").Return(ontotextSuggestion, nil).Twice()
+	suggestionApi.On("FilterSuggestions", ontotextSuggestion.Suggestions, mock.Anything).Return(ontotextSuggestion.Suggestions).Twice()
+
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"concepts":{"ontotext-suggestion-api":{"id":"ontotext-suggestion-api","apiUrl":"apiurl1","prefLabel":"prefLabel1","type":"http://www.ft.com/ontology/person/Person"}}}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"concepts":{"ontotext-suggestion-api":{"id":"ontotext-suggestion-api","apiUrl":"apiurl1","prefLabel":"prefLabel1","type":"http://www.ft.com/ontology/person/Person"}}}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+
+	mockClientPublicThings := new(mockHttpClient)
+	mockClientPublicThings.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"things":{}}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	mockClientPublicThings.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"things":{}}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	broaderProvider := NewBroaderConceptsProvider("publicThingsUrl", "/things", mockClientPublicThings)
+
+	blacklisterMock := new(mockHttpClient)
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"uuids":["another-concept"]}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"uuids":["another-concept"]}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	blacklister := NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
+
+	aggregateSuggester := NewAggregateSuggester(log, mockConcordance, broaderProvider, blacklister, suggestionApi)
+	aggregateSuggester.Cache = NewResponseCache(time.Minute, 10)
+
+	// first call populates the cache
+	response, err := aggregateSuggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal(ontotextSuggestion.Suggestions, response.Suggestions)
+
+	// second identical call with the same blacklist is answered from the cache, while the changed blacklist is retrieved
+	response, err = aggregateSuggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal(ontotextSuggestion.Suggestions, response.Suggestions)
+	suggestionApi.AssertNumberOfCalls(t, "GetSuggestions", 1)
+
+	for i := 0; i < 100; i++ {
+		if last, _ := blacklister.LastBlacklist(); len(last.UUIDS) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the blacklist change invalidates the cache
+	response, err = aggregateSuggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal(ontotextSuggestion.Suggestions, response.Suggestions)
+	suggestionApi.AssertNumberOfCalls(t, "GetSuggestions", 2)
+
+	suggestionApi.AssertExpectations(t)
+	mockClient.AssertExpectations(t)
+	blacklisterMock.AssertExpectations(t)
+}
+
+// signallingSuggester closes called when it's first asked for suggestions and counts the calls
+type signallingSuggester struct {
+	staticSuggester
+	called chan struct{}
+	once   sync.Once
+	calls  int32
+}
+
+func (s *signallingSuggester) GetSuggestions(payload []byte, tid string) (SuggestionsResponse, error) {
+	atomic.AddInt32(&s.calls, 1)
+	s.once.Do(func() { close(s.called) })
+	return s.staticSuggester.GetSuggestions(payload, tid)
+}
+
+func TestAggregateSuggester_CachedSuggestionsRequestedWhileBlacklistIsRetrieved(t *testing.T) {
+	expect := assert.New(t)
+
+	delegate := &signallingSuggester{staticSuggester: staticSuggester{name: "Test Suggestion API", response: locations("a")}, called: make(chan struct{})}
+	suggester, closeServer := newTestAggregateSuggester(delegate)
+	defer closeServer()
+	suggester.Cache = NewResponseCache(time.Hour, 10)
+
+	blacklisterServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-delegate.called:
+			w.Write([]byte(`{"uuids": []}`))
+		case <-time.After(2 * time.Second):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer blacklisterServer.Close()
+	suggester.Blacklister = NewConceptBlacklister(blacklisterServer.URL, "/blacklist", http.DefaultClient)
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Len(response.Suggestions, 1)
+
+	// the blacklist was retrieved once the suggestions were requested, so the response was cached
+	response, err = suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Len(response.Suggestions, 1)
+	expect.Equal(int32(1), atomic.LoadInt32(&delegate.calls))
+}
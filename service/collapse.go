@@ -0,0 +1,18 @@
+package service
+
+import "golang.org/x/sync/singleflight"
+
+// requestCollapser shares a single call between the concurrent callers asking for the same key, unless collapsing is disabled
+type requestCollapser struct {
+	group    singleflight.Group
+	disabled bool
+}
+
+// Do runs fn for the key, or waits for the in-flight call with the same key and shares its result, which is then reported as shared
+func (c *requestCollapser) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	if c.disabled {
+		result, err := fn()
+		return result, err, false
+	}
+	return c.group.Do(key, fn)
+}
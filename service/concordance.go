@@ -1,16 +1,24 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/Financial-Times/go-fthealth/v1_1"
 )
 
 const idsParamName = "ids"
 
+// concordanceRejectedError is matched by the 4xx statuses of internal concordances, which mean the request was rejected rather than the service failing
+var concordanceRejectedError = errors.New("internal concordances rejected the request")
+
 type ConcordanceService struct {
 	systemId            string
 	name                string
@@ -18,6 +26,9 @@ type ConcordanceService struct {
 	ConcordanceEndpoint string
 	Client              Client
 	failureImpact       string
+	inFlight            requestCollapser
+	traffic             *TrafficMonitor
+	regions             *regionFailover
 }
 
 type ConcordanceResponse struct {
@@ -47,30 +58,41 @@ func (concordance *ConcordanceService) Check() v1_1.Check {
 	}
 }
 
-func (concordance *ConcordanceService) healthCheck() (string, error) {
-	req, err := http.NewRequest("GET", concordance.ConcordanceBaseURL+"/__gtg", nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Add("User-Agent", "UPP public-suggestions-api")
-
-	resp, err := concordance.Client.Do(req)
-	if err != nil {
-		return "", err
-	}
+// MonitorTraffic makes the health check report the errors and latencies of the calls made for concordances
+func (concordance *ConcordanceService) MonitorTraffic(monitor *TrafficMonitor) {
+	concordance.traffic = monitor
+}
 
-	defer resp.Body.Close()
+// DisableRequestCollapsing makes every caller fetch its concordances itself, e.g. so that each transaction gets its own downstream call while recording
+func (concordance *ConcordanceService) DisableRequestCollapsing() {
+	concordance.inFlight.disabled = true
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Health check returned a non-200 HTTP status: %v", resp.StatusCode)
+func (concordance *ConcordanceService) healthCheck() (string, error) {
+	if concordance.regions != nil {
+		return concordance.checkRegions()
 	}
-	return fmt.Sprintf("%v is healthy", concordance.name), nil
+	return checkGTG(concordance.name, concordance.Client, concordance.ConcordanceBaseURL, concordance.traffic)
 }
 
+// getConcordances retrieves the concordances of the given concept IDs, sharing a single downstream call between concurrent callers asking for the same IDs
 func (concordance *ConcordanceService) getConcordances(ids []string, tid string) (ConcordanceResponse, error) {
+	key := make([]string, len(ids))
+	copy(key, ids)
+	sort.Strings(key)
+
+	result, err, _ := concordance.inFlight.Do(strings.Join(key, ","), func() (interface{}, error) {
+		start := time.Now()
+		concorded, err := concordance.fetchFromActiveRegion(ids, tid)
+		concordance.traffic.Record(time.Since(start), isConcordanceFailure(err))
+		return concorded, err
+	})
+	return result.(ConcordanceResponse), err
+}
+
+func (concordance *ConcordanceService) fetchConcordances(ctx context.Context, baseURL string, ids []string, tid string) (ConcordanceResponse, error) {
 	var concorded ConcordanceResponse
-	req, err := http.NewRequest("GET", concordance.ConcordanceBaseURL+concordance.ConcordanceEndpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+concordance.ConcordanceEndpoint, nil)
 	if err != nil {
 		return concorded, err
 	}
@@ -94,7 +116,7 @@ func (concordance *ConcordanceService) getConcordances(ids []string, tid string)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return concorded, fmt.Errorf("non 200 status code returned: %d", resp.StatusCode)
+		return concorded, &statusError{status: resp.StatusCode}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -105,3 +127,21 @@ func (concordance *ConcordanceService) getConcordances(ids []string, tid string)
 	err = json.Unmarshal(body, &concorded)
 	return concorded, err
 }
+
+// statusError is a non 200 status returned by internal concordances
+type statusError struct {
+	status int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("non 200 status code returned: %d", e.status)
+}
+
+func (e *statusError) Is(target error) bool {
+	return target == concordanceRejectedError && e.status >= 400 && e.status < 500
+}
+
+// isConcordanceFailure tells whether a call error means internal concordances is failing, as opposed to it rejecting the request
+func isConcordanceFailure(err error) bool {
+	return err != nil && !errors.Is(err, concordanceRejectedError)
+}
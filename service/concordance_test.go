@@ -3,8 +3,11 @@ package service
 import (
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -73,3 +76,170 @@ func TestConcordanceService_CheckHealthErrorOnRequestDo(t *testing.T) {
 	expect.Empty(checkResult)
 	mockClient.AssertExpectations(t)
 }
+
+func TestConcordanceService_GetConcordancesCollapsesIdenticalRequests(t *testing.T) {
+	expect := assert.New(t)
+
+	var calls int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		w.Write([]byte(`{"concepts":{"first":{"id":"http://www.ft.com/thing/first"},"second":{"id":"http://www.ft.com/thing/second"}}}`))
+	}))
+	defer server.Close()
+
+	concordance := NewConcordance(server.URL, "/internalconcordances", http.DefaultClient)
+
+	responses := make(chan ConcordanceResponse, 2)
+	go func() {
+		response, _ := concordance.getConcordances([]string{"first", "second"}, "tid_first")
+		responses <- response
+	}()
+	<-started
+	go func() {
+		response, _ := concordance.getConcordances([]string{"second", "first"}, "tid_second")
+		responses <- response
+	}()
+	// give the second request time to join the in-flight one
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	expect.Len((<-responses).Concepts, 2)
+	expect.Len((<-responses).Concepts, 2)
+	expect.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+// newRegion serves concordances with the given status after the given delay, and GTG with the given status
+func newRegion(status int, delay time.Duration, gtgStatus int, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/__gtg" {
+			w.WriteHeader(gtgStatus)
+			return
+		}
+		atomic.AddInt32(calls, 1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"concepts":{"first":{"id":"http://www.ft.com/thing/first"}}}`))
+	}))
+}
+
+func TestConcordanceService_FailoverOnError(t *testing.T) {
+	expect := assert.New(t)
+
+	var primaryCalls, secondaryCalls int32
+	primary := newRegion(http.StatusServiceUnavailable, 0, http.StatusOK, &primaryCalls)
+	defer primary.Close()
+	secondary := newRegion(http.StatusOK, 0, http.StatusOK, &secondaryCalls)
+	defer secondary.Close()
+
+	concordance := NewConcordance(primary.URL, "/internalconcordances", http.DefaultClient)
+	concordance.FailoverTo(secondary.URL, time.Second)
+
+	response, err := concordance.getConcordances([]string{"first"}, "tid_test")
+	expect.NoError(err)
+	expect.Len(response.Concepts, 1)
+	expect.Equal(SecondaryRegion, concordance.ActiveRegion())
+
+	// the secondary region stays active
+	_, err = concordance.getConcordances([]string{"first"}, "tid_test")
+	expect.NoError(err)
+	expect.Equal(int32(1), atomic.LoadInt32(&primaryCalls))
+	expect.Equal(int32(2), atomic.LoadInt32(&secondaryCalls))
+
+	// until the health check finds the primary region healthy
+	output, err := concordance.Check().Checker()
+	expect.NoError(err)
+	expect.Equal("internal-concordances is healthy, active region: primary ("+primary.URL+")", output)
+	expect.Equal(PrimaryRegion, concordance.ActiveRegion())
+}
+
+func TestConcordanceService_FailoverOnTimeout(t *testing.T) {
+	expect := assert.New(t)
+
+	var primaryCalls, secondaryCalls int32
+	primary := newRegion(http.StatusOK, 5*time.Second, http.StatusOK, &primaryCalls)
+	defer primary.Close()
+	secondary := newRegion(http.StatusOK, 0, http.StatusOK, &secondaryCalls)
+	defer secondary.Close()
+
+	concordance := NewConcordance(primary.URL, "/internalconcordances", http.DefaultClient)
+	concordance.FailoverTo(secondary.URL, 50*time.Millisecond)
+
+	start := time.Now()
+	response, err := concordance.getConcordances([]string{"first"}, "tid_test")
+	expect.NoError(err)
+	expect.Len(response.Concepts, 1)
+	expect.True(time.Since(start) < time.Second)
+	expect.Equal(SecondaryRegion, concordance.ActiveRegion())
+}
+
+func TestConcordanceService_NoFailoverOnRejectedRequest(t *testing.T) {
+	expect := assert.New(t)
+
+	var primaryCalls, secondaryCalls int32
+	primary := newRegion(http.StatusBadRequest, 0, http.StatusOK, &primaryCalls)
+	defer primary.Close()
+	secondary := newRegion(http.StatusOK, 0, http.StatusOK, &secondaryCalls)
+	defer secondary.Close()
+
+	concordance := NewConcordance(primary.URL, "/internalconcordances", http.DefaultClient)
+	concordance.FailoverTo(secondary.URL, time.Second)
+
+	_, err := concordance.getConcordances([]string{"first"}, "tid_test")
+	expect.EqualError(err, "non 200 status code returned: 400")
+	expect.True(errors.Is(err, concordanceRejectedError))
+	expect.False(errors.Is(err, BadRequestError))
+	expect.Equal(PrimaryRegion, concordance.ActiveRegion())
+	expect.Equal(int32(1), atomic.LoadInt32(&primaryCalls))
+	expect.Equal(int32(0), atomic.LoadInt32(&secondaryCalls))
+}
+
+func TestConcordanceService_BothRegionsFailing(t *testing.T) {
+	expect := assert.New(t)
+
+	var primaryCalls, secondaryCalls int32
+	primary := newRegion(http.StatusServiceUnavailable, 0, http.StatusServiceUnavailable, &primaryCalls)
+	defer primary.Close()
+	secondary := newRegion(http.StatusInternalServerError, 0, http.StatusServiceUnavailable, &secondaryCalls)
+	defer secondary.Close()
+
+	concordance := NewConcordance(primary.URL, "/internalconcordances", http.DefaultClient)
+	concordance.FailoverTo(secondary.URL, time.Second)
+
+	_, err := concordance.getConcordances([]string{"first"}, "tid_test")
+	expect.EqualError(err, "primary region failed: non 200 status code returned: 503, secondary region failed: non 200 status code returned: 500")
+	expect.Equal(PrimaryRegion, concordance.ActiveRegion())
+
+	_, err = concordance.Check().Checker()
+	expect.EqualError(err, "Both regions are unavailable, primary region: Health check returned a non-200 HTTP status: 503, secondary region: Health check returned a non-200 HTTP status: 503")
+}
+
+func TestConcordanceService_CheckReportsUnavailablePrimaryRegion(t *testing.T) {
+	expect := assert.New(t)
+
+	var primaryCalls, secondaryCalls int32
+	primary := newRegion(http.StatusOK, 0, http.StatusServiceUnavailable, &primaryCalls)
+	defer primary.Close()
+	secondary := newRegion(http.StatusOK, 0, http.StatusOK, &secondaryCalls)
+	defer secondary.Close()
+
+	concordance := NewConcordance(primary.URL, "/internalconcordances", http.DefaultClient)
+	concordance.FailoverTo(secondary.URL, time.Second)
+
+	output, err := concordance.Check().Checker()
+	expect.NoError(err)
+	expect.Equal("internal-concordances is healthy, active region: secondary ("+secondary.URL+"), primary region unavailable: Health check returned a non-200 HTTP status: 503", output)
+
+	_, err = concordance.getConcordances([]string{"first"}, "tid_test")
+	expect.NoError(err)
+	expect.Equal(int32(0), atomic.LoadInt32(&primaryCalls))
+	expect.Equal(int32(1), atomic.LoadInt32(&secondaryCalls))
+}
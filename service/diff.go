@@ -0,0 +1,110 @@
+package service
+
+import (
+	fp "path/filepath"
+)
+
+type Annotation struct {
+	ID string `json:"id"`
+	// Predicate is optional, an annotation without predicate matching the suggestions of its concept whatever their predicate
+	Predicate string `json:"predicate,omitempty"`
+}
+
+type AnnotationsDiff struct {
+	Added                   []Suggestion `json:"added"`
+	AlreadyPresent          []Suggestion `json:"alreadyPresent"`
+	ExistingButNotSuggested []Suggestion `json:"existingButNotSuggested"`
+	// Variant is the experiment variant which served the suggestions, if any
+	Variant string `json:"-"`
+}
+
+// GetSuggestionsDiff aggregates suggestions for the given payload and compares them against the existing annotations of the content.
+// Existing annotations are resolved to their canonical concepts using internal concordances, so that equivalent IDs compare equal,
+// and a suggestion is already present when an annotation has both its concept and its predicate.
+func (s *AggregateSuggester) GetSuggestionsDiff(payload []byte, existing []Annotation, tid string) (AnnotationsDiff, error) {
+	diff := AnnotationsDiff{
+		Added:                   make([]Suggestion, 0),
+		AlreadyPresent:          make([]Suggestion, 0),
+		ExistingButNotSuggested: make([]Suggestion, 0),
+	}
+
+	suggestions, err := s.GetSuggestions(payload, tid)
+	if err != nil {
+		return diff, err
+	}
+	diff.Variant = suggestions.Variant
+
+	canonical, err := s.canonicalizeAnnotations(existing, tid)
+	if err != nil {
+		return diff, err
+	}
+
+	existingKeys := make(map[string]bool, len(canonical))
+	for _, annotation := range canonical {
+		existingKeys[annotationKey(annotation)] = true
+	}
+
+	suggestedKeys := make(map[string]bool, 2*len(suggestions.Suggestions))
+	for _, suggestion := range suggestions.Suggestions {
+		key := annotationKey(suggestion)
+		anyPredicateKey := annotationKey(Suggestion{Concept: suggestion.Concept})
+		suggestedKeys[key] = true
+		suggestedKeys[anyPredicateKey] = true
+		if existingKeys[key] || existingKeys[anyPredicateKey] {
+			diff.AlreadyPresent = append(diff.AlreadyPresent, suggestion)
+		} else {
+			diff.Added = append(diff.Added, suggestion)
+		}
+	}
+
+	for _, annotation := range canonical {
+		if !suggestedKeys[annotationKey(annotation)] {
+			diff.ExistingButNotSuggested = append(diff.ExistingButNotSuggested, annotation)
+		}
+	}
+
+	return diff, nil
+}
+
+func (s *AggregateSuggester) canonicalizeAnnotations(annotations []Annotation, tid string) ([]Suggestion, error) {
+	var ids []string
+	for _, annotation := range annotations {
+		ids = append(ids, fp.Base(annotation.ID))
+	}
+	ids = dedup(ids)
+
+	if len(ids) == 0 {
+		return []Suggestion{}, nil
+	}
+
+	concorded, err := s.Concordance.getConcordances(ids, tid)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Suggestion
+	seen := make(map[string]bool, len(annotations))
+	for _, annotation := range annotations {
+		concept, ok := concorded.Concepts[fp.Base(annotation.ID)]
+		if !ok {
+			// keep annotations to concepts unknown to concordances, so they are still reported back to the client
+			concept = Concept{ID: annotation.ID}
+		}
+		result := Suggestion{
+			Predicate: annotation.Predicate,
+			Concept:   concept,
+		}
+		key := annotationKey(result)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// annotationKey identifies an annotation by the UUID of its concept and its predicate
+func annotationKey(annotation Suggestion) string {
+	return fp.Base(annotation.ID) + " " + annotation.Predicate
+}
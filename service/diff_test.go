@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAggregateSuggester_GetSuggestionsDiff(t *testing.T) {
+	expect := assert.New(t)
+
+	suggestionApi := new(mockSuggestionApi)
+	log := logger.NewUPPLogger("test-service", "panic")
+	mockClient := new(mockHttpClient)
+	mockConcordance := NewConcordance("internalConcordancesHost", "/internalconcordances", mockClient)
+
+	london := Concept{ID: "http://www.ft.com/thing/f758ef56-c40a-3162-91aa-3e8a3aabc495", PrefLabel: "London", Type: ontologyLocationType}
+	apple := Concept{ID: "http://www.ft.com/thing/9332270e-f959-3f55-9153-d30acd0d0a55", PrefLabel: "Apple", Type: ontologyOrganisationType}
+	platt := Concept{ID: "http://www.ft.com/thing/64302452-e369-4ddb-88fa-9adc5124a385", PrefLabel: "Eric Platt", Type: ontologyPersonType}
+
+	ontotextSuggestion := SuggestionsResponse{Suggestions: []Suggestion{
+		{Predicate: "http://www.ft.com/ontology/annotation/about", Concept: london},
+		{Predicate: "http://www.ft.com/ontology/annotation/mentions", Concept: apple},
+	}}
+	suggestionApi.On("GetSuggestions", mock.AnythingOfType("[]uint8"), "tid_test").Return(ontotextSuggestion, nil).Once()
+	suggestionApi.On("FilterSuggestions", ontotextSuggestion.Suggestions, mock.Anything).Return(ontotextSuggestion.Suggestions).Once()
+
+	// concordances for the suggestions
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body: ioutil.NopCloser(strings.NewReader(`{"concepts":{
+			"f758ef56-c40a-3162-91aa-3e8a3aabc495":{"id":"http://www.ft.com/thing/f758ef56-c40a-3162-91aa-3e8a3aabc495","prefLabel":"London","type":"http://www.ft.com/ontology/Location"},
+			"9332270e-f959-3f55-9153-d30acd0d0a55":{"id":"http://www.ft.com/thing/9332270e-f959-3f55-9153-d30acd0d0a55","prefLabel":"Apple","type":"http://www.ft.com/ontology/organisation/Organisation"}
+		}}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	// concordances for the existing annotations, where a source ID resolves to the canonical London concept
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body: ioutil.NopCloser(strings.NewReader(`{"concepts":{
+			"0e5033fe-d079-4a7d-a3cf-8b6e2b46a6b5":{"id":"http://www.ft.com/thing/f758ef56-c40a-3162-91aa-3e8a3aabc495","prefLabel":"London","type":"http://www.ft.com/ontology/Location"},
+			"64302452-e369-4ddb-88fa-9adc5124a385":{"id":"http://www.ft.com/thing/64302452-e369-4ddb-88fa-9adc5124a385","prefLabel":"Eric Platt","type":"http://www.ft.com/ontology/person/Person"}
+		}}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+
+	mockClientPublicThings := new(mockHttpClient)
+	mockClientPublicThings.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"things":{}}`)),
+		StatusCode: http.StatusOK,
+	}, nil)
+	broaderProvider := NewBroaderConceptsProvider("publicThingsUrl", "/things", mockClientPublicThings)
+
+	blacklisterMock := new(mockHttpClient)
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil)
+	blacklister := NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
+
+	aggregateSuggester := NewAggregateSuggester(log, mockConcordance, broaderProvider, blacklister, suggestionApi)
+	diff, err := aggregateSuggester.GetSuggestionsDiff([]byte{}, []Annotation{
+		{ID: "http://www.ft.com/thing/0e5033fe-d079-4a7d-a3cf-8b6e2b46a6b5", Predicate: "http://www.ft.com/ontology/annotation/about"},
+		{ID: "http://www.ft.com/thing/64302452-e369-4ddb-88fa-9adc5124a385", Predicate: "http://www.ft.com/ontology/annotation/mentions"},
+	}, "tid_test")
+
+	expect.NoError(err)
+	expect.Equal([]Suggestion{ontotextSuggestion.Suggestions[1]}, diff.Added)
+	expect.Equal([]Suggestion{ontotextSuggestion.Suggestions[0]}, diff.AlreadyPresent)
+	expect.Equal([]Suggestion{{Predicate: "http://www.ft.com/ontology/annotation/mentions", Concept: platt}}, diff.ExistingButNotSuggested)
+
+	suggestionApi.AssertExpectations(t)
+	mockClient.AssertExpectations(t)
+}
+
+func TestAggregateSuggester_GetSuggestionsDiffConcordanceError(t *testing.T) {
+	expect := assert.New(t)
+
+	suggestionApi := new(mockSuggestionApi)
+	log := logger.NewUPPLogger("test-service", "panic")
+	mockClient := new(mockHttpClient)
+	mockConcordance := NewConcordance("internalConcordancesHost", "/internalconcordances", mockClient)
+
+	suggestionApi.On("GetSuggestions", mock.AnythingOfType("[]uint8"), "tid_test").Return(SuggestionsResponse{Suggestions: []Suggestion{}}, nil).Once()
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{}, errors.New("timeout error"))
+
+	blacklisterMock := new(mockHttpClient)
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil)
+	blacklister := NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
+
+	aggregateSuggester := NewAggregateSuggester(log, mockConcordance, NewBroaderConceptsProvider("publicThingsUrl", "/things", new(mockHttpClient)), blacklister, suggestionApi)
+	diff, err := aggregateSuggester.GetSuggestionsDiff([]byte{}, []Annotation{
+		{ID: "http://www.ft.com/thing/64302452-e369-4ddb-88fa-9adc5124a385"},
+	}, "tid_test")
+
+	expect.EqualError(err, "timeout error")
+	expect.Empty(diff.Added)
+	expect.Empty(diff.AlreadyPresent)
+	expect.Empty(diff.ExistingButNotSuggested)
+}
+
+func TestAggregateSuggester_GetSuggestionsDiffComparesPredicates(t *testing.T) {
+	expect := assert.New(t)
+
+	about := "http://www.ft.com/ontology/annotation/about"
+	mentions := "http://www.ft.com/ontology/annotation/mentions"
+	suggestions := locations("a", "b")
+	suggestions.Suggestions[0].Predicate = about
+	suggestions.Suggestions[1].Predicate = mentions
+
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Test Suggestion API", response: suggestions})
+	defer closeServer()
+
+	diff, err := suggester.GetSuggestionsDiff([]byte(`{"bodyXML":"Test body"}`), []Annotation{
+		{ID: "http://www.ft.com/thing/a", Predicate: mentions},
+		// without predicate, the concept matches whatever its predicate
+		{ID: "http://www.ft.com/thing/b"},
+		{ID: "http://www.ft.com/thing/c", Predicate: about},
+	}, "tid_test")
+	expect.NoError(err)
+
+	annotations := func(suggestions []Suggestion) []Annotation {
+		result := []Annotation{}
+		for _, suggestion := range suggestions {
+			result = append(result, Annotation{ID: suggestion.ID, Predicate: suggestion.Predicate})
+		}
+		return result
+	}
+	expect.Equal([]Annotation{{ID: "http://www.ft.com/thing/a", Predicate: about}}, annotations(diff.Added))
+	expect.Equal([]Annotation{{ID: "http://www.ft.com/thing/b", Predicate: mentions}}, annotations(diff.AlreadyPresent))
+	expect.Equal([]Annotation{{ID: "http://www.ft.com/thing/a", Predicate: mentions}, {ID: "http://www.ft.com/thing/c", Predicate: about}}, annotations(diff.ExistingButNotSuggested))
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	fp "path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+	"gopkg.in/yaml.v2"
+)
+
+// EditorialRule suppresses or adds concepts when its condition matches the content and its suggestions
+type EditorialRule struct {
+	Name string `yaml:"name"`
+	// Suppress are the UUIDs or URIs of the concepts removed from the suggestions, URIs being reduced to their UUID when loaded
+	Suppress []string `yaml:"suppress"`
+	// Predicates restrict the suppression to the suggestions with one of these predicates, all of them being suppressed when empty
+	Predicates []string `yaml:"predicates"`
+	// Add are the concepts added to the suggestions when they are not suggested already
+	Add  []EditorialConcept `yaml:"add"`
+	When EditorialCondition `yaml:"when"`
+}
+
+type EditorialConcept struct {
+	ID        string `yaml:"id"`
+	APIURL    string `yaml:"apiUrl"`
+	Type      string `yaml:"type"`
+	PrefLabel string `yaml:"prefLabel"`
+	Predicate string `yaml:"predicate"`
+}
+
+// EditorialCondition matches when all its criteria which are set match, a criterion matching when any of its values does.
+// An empty condition matches any content.
+type EditorialCondition struct {
+	// Present are the UUIDs or URIs of the concepts of which one must be suggested, URIs being reduced to their UUID when loaded
+	Present []string `yaml:"present"`
+	// Bylines are looked up case insensitively in the byline of the content
+	Bylines []string `yaml:"bylines"`
+	// ContentTypes are compared with the type of the content, e.g. Article or http://www.ft.com/ontology/content/Article
+	ContentTypes []string `yaml:"contentTypes"`
+}
+
+type editorialRulesFile struct {
+	Rules []EditorialRule `yaml:"rules"`
+}
+
+// EditorialRules are the rules edited in a YAML file, which are reloaded whenever the file changes.
+// Invalid changes are ignored, the rules loaded last staying in place.
+type EditorialRules struct {
+	path           string
+	log            *logger.UPPLogger
+	mutex          sync.RWMutex
+	rules          []EditorialRule
+	version        string
+	reloadFailures metrics.Counter
+}
+
+// LoadEditorialRules loads the rules of the given file, failing when the file can't be read or the rules are not valid
+func LoadEditorialRules(path string, log *logger.UPPLogger) (*EditorialRules, error) {
+	r := &EditorialRules{
+		path:           path,
+		log:            log,
+		reloadFailures: metrics.GetOrRegisterCounter("editorial-rules.reload.failures", metrics.DefaultRegistry),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the rules file again, replacing the current rules when the file changed and its rules are valid
+func (r *EditorialRules) Reload() (bool, error) {
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(data)
+	version := hex.EncodeToString(hash[:])
+	if version == r.Version() {
+		return false, nil
+	}
+
+	var file editorialRulesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return false, fmt.Errorf("editorial rules file %s is not valid: %w", r.path, err)
+	}
+	if err := validateEditorialRules(file.Rules); err != nil {
+		return false, err
+	}
+	normalizeEditorialRules(file.Rules)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rules = file.Rules
+	r.version = version
+	return true, nil
+}
+
+// ReloadInBackground reloads the rules every interval, the rules are never reloaded when the interval is not positive.
+// It returns a function stopping the reloads.
+func (r *EditorialRules) ReloadInBackground(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reloaded, err := r.Reload()
+				if err != nil {
+					r.reloadFailures.Inc(1)
+					r.log.WithError(err).Error("Editorial rules could not be reloaded, keeping the current rules")
+				} else if reloaded {
+					r.log.Infof("Editorial rules reloaded from %s, %d rules", r.path, len(r.Rules()))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// Rules returns the current rules
+func (r *EditorialRules) Rules() []EditorialRule {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.rules
+}
+
+// Version identifies the content of the rules file loaded last
+func (r *EditorialRules) Version() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.version
+}
+
+func validateEditorialRules(rules []EditorialRule) error {
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("editorial rule %d has no name", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("editorial rule %q is defined more than once", rule.Name)
+		}
+		names[rule.Name] = true
+		if len(rule.Suppress) == 0 && len(rule.Add) == 0 {
+			return fmt.Errorf("editorial rule %q neither suppresses nor adds concepts", rule.Name)
+		}
+		for _, concept := range rule.Add {
+			if concept.ID == "" {
+				return fmt.Errorf("editorial rule %q adds a concept without id", rule.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeEditorialRules reduces the concept URIs of the rules to their UUID, which is what the suggestions are compared on
+func normalizeEditorialRules(rules []EditorialRule) {
+	for i := range rules {
+		for j, id := range rules[i].Suppress {
+			rules[i].Suppress[j] = fp.Base(id)
+		}
+		for j, id := range rules[i].When.Present {
+			rules[i].When.Present[j] = fp.Base(id)
+		}
+	}
+}
+
+func (c EditorialCondition) matches(content ContentAttributes, present map[string]bool) bool {
+	if len(c.Present) > 0 && !anyOf(c.Present, func(uuid string) bool { return present[uuid] }) {
+		return false
+	}
+	if len(c.Bylines) > 0 && !anyOf(c.Bylines, func(byline string) bool {
+		return strings.Contains(strings.ToLower(content.Byline), strings.ToLower(byline))
+	}) {
+		return false
+	}
+	if len(c.ContentTypes) > 0 && !anyOf(c.ContentTypes, func(contentType string) bool {
+		return content.Type != "" && strings.EqualFold(fp.Base(content.Type), fp.Base(contentType))
+	}) {
+		return false
+	}
+	return true
+}
+
+func (rule EditorialRule) suppresses(suggestion Suggestion) bool {
+	id := fp.Base(suggestion.ID)
+	if !anyOf(rule.Suppress, func(uuid string) bool { return uuid == id }) {
+		return false
+	}
+	return len(rule.Predicates) == 0 || anyOf(rule.Predicates, func(predicate string) bool { return predicate == suggestion.Predicate })
+}
+
+func anyOf(values []string, match func(string) bool) bool {
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// EditorialRulesProcessor applies the editorial rules to the suggestions.
+// The conditions of the rules are evaluated against the suggestions entering the stage, then the matching rules suppress their concepts
+// and add theirs along with the suggestions of the last suggester, so a concept both suppressed and added is returned.
+type EditorialRulesProcessor struct {
+	// Rules are optional, no suggestion is changed without them
+	Rules *EditorialRules
+}
+
+func (p *EditorialRulesProcessor) Name() string {
+	return EditorialRulesStage
+}
+
+// Version identifies the current rules, so that the responses processed with other rules are not served from the response cache
+func (p *EditorialRulesProcessor) Version() string {
+	if p.Rules == nil {
+		return ""
+	}
+	return p.Rules.Version()
+}
+
+func (p *EditorialRulesProcessor) Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	if p.Rules == nil {
+		return suggestions, nil
+	}
+
+	present := map[string]bool{}
+	for _, sourceSuggestions := range suggestions {
+		for _, suggestion := range sourceSuggestions {
+			present[fp.Base(suggestion.ID)] = true
+		}
+	}
+
+	var matching []EditorialRule
+	for _, rule := range p.Rules.Rules() {
+		if rule.When.matches(request.Content, present) {
+			matching = append(matching, rule)
+		}
+	}
+	if len(matching) == 0 {
+		return suggestions, nil
+	}
+
+	processed := make(map[int][]Suggestion, len(suggestions))
+	for key, sourceSuggestions := range suggestions {
+		processed[key] = []Suggestion{}
+	suggestionsLoop:
+		for _, suggestion := range sourceSuggestions {
+			for _, rule := range matching {
+				if rule.suppresses(suggestion) {
+					request.Log.Debugf("Editorial rule %s suppressed %s", rule.Name, suggestion.ID)
+					continue suggestionsLoop
+				}
+			}
+			processed[key] = append(processed[key], suggestion)
+		}
+	}
+
+	if len(request.Suggesters) == 0 {
+		return processed, nil
+	}
+	last := len(request.Suggesters) - 1
+	for _, rule := range matching {
+		for _, concept := range rule.Add {
+			id := fp.Base(concept.ID)
+			if isSuggested(processed, id) {
+				continue
+			}
+			request.Log.Debugf("Editorial rule %s added %s", rule.Name, concept.ID)
+			processed[last] = append(processed[last], Suggestion{
+				Concept:   Concept{ID: concept.ID, APIURL: concept.APIURL, Type: concept.Type, PrefLabel: concept.PrefLabel},
+				Predicate: concept.Predicate,
+			})
+		}
+	}
+	return processed, nil
+}
+
+func isSuggested(suggestions map[int][]Suggestion, id string) bool {
+	for _, sourceSuggestions := range suggestions {
+		for _, suggestion := range sourceSuggestions {
+			if fp.Base(suggestion.ID) == id {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEditorialRules = `
+rules:
+  - name: a-with-b
+    suppress: [a]
+    when:
+      present: [b]
+  - name: c-not-about-for-blogs
+    suppress: [c]
+    predicates: [http://www.ft.com/ontology/annotation/about]
+    when:
+      contentTypes: [LiveBlogPost]
+  - name: lex-brand
+    add:
+      - id: http://www.ft.com/thing/lex
+        type: http://www.ft.com/ontology/product/Brand
+        prefLabel: Lex
+        predicate: http://www.ft.com/ontology/classification/isClassifiedBy
+    when:
+      bylines: [lex]
+`
+
+func writeEditorialRules(t *testing.T, rules string) (string, func()) {
+	dir, err := ioutil.TempDir("", "editorial-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rules.yml")
+	if err := ioutil.WriteFile(path, []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func loadTestEditorialRules(t *testing.T) *EditorialRules {
+	path, remove := writeEditorialRules(t, testEditorialRules)
+	defer remove()
+	rules, err := LoadEditorialRules(path, logger.NewUPPLogger("test-service", "panic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func suggestionIDs(suggestions map[int][]Suggestion) map[int][]string {
+	ids := make(map[int][]string, len(suggestions))
+	for key, sourceSuggestions := range suggestions {
+		ids[key] = []string{}
+		for _, suggestion := range sourceSuggestions {
+			ids[key] = append(ids[key], suggestion.ID)
+		}
+	}
+	return ids
+}
+
+func TestEditorialRulesProcessor_Process(t *testing.T) {
+	about := "http://www.ft.com/ontology/annotation/about"
+	mentions := "http://www.ft.com/ontology/annotation/mentions"
+
+	tests := []struct {
+		name        string
+		content     ContentAttributes
+		suggestions map[int][]Suggestion
+		expected    map[int][]string
+	}{
+		{
+			name:        "suppressed when another concept is present",
+			suggestions: map[int][]Suggestion{0: {}, 1: {{Concept: Concept{ID: "http://www.ft.com/thing/a"}}, {Concept: Concept{ID: "http://www.ft.com/thing/b"}}}},
+			expected:    map[int][]string{0: {}, 1: {"http://www.ft.com/thing/b"}},
+		},
+		{
+			name:        "kept when the other concept is absent",
+			suggestions: map[int][]Suggestion{0: {}, 1: {{Concept: Concept{ID: "http://www.ft.com/thing/a"}}}},
+			expected:    map[int][]string{0: {}, 1: {"http://www.ft.com/thing/a"}},
+		},
+		{
+			name:    "suppressed for the content type and predicate only",
+			content: ContentAttributes{Type: "http://www.ft.com/ontology/content/LiveBlogPost"},
+			suggestions: map[int][]Suggestion{0: {}, 1: {
+				{Concept: Concept{ID: "http://www.ft.com/thing/c"}, Predicate: about},
+				{Concept: Concept{ID: "http://www.ft.com/thing/c"}, Predicate: mentions},
+			}},
+			expected: map[int][]string{0: {}, 1: {"http://www.ft.com/thing/c"}},
+		},
+		{
+			name:        "kept for other content types",
+			content:     ContentAttributes{Type: "Article"},
+			suggestions: map[int][]Suggestion{0: {}, 1: {{Concept: Concept{ID: "http://www.ft.com/thing/c"}, Predicate: about}}},
+			expected:    map[int][]string{0: {}, 1: {"http://www.ft.com/thing/c"}},
+		},
+		{
+			name:        "added for the byline",
+			content:     ContentAttributes{Byline: "Lex"},
+			suggestions: map[int][]Suggestion{0: {}, 1: {{Concept: Concept{ID: "http://www.ft.com/thing/b"}}}},
+			expected:    map[int][]string{0: {}, 1: {"http://www.ft.com/thing/b", "http://www.ft.com/thing/lex"}},
+		},
+		{
+			name:        "not added twice",
+			content:     ContentAttributes{Byline: "The Lex column"},
+			suggestions: map[int][]Suggestion{0: {{Concept: Concept{ID: "http://www.ft.com/thing/lex"}}}, 1: {}},
+			expected:    map[int][]string{0: {"http://www.ft.com/thing/lex"}, 1: {}},
+		},
+	}
+
+	processor := &EditorialRulesProcessor{Rules: loadTestEditorialRules(t)}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := newProcessingRequest()
+			request.Suggesters = []Suggester{&staticSuggester{}, &staticSuggester{}}
+			request.Content = test.content
+
+			processed, err := processor.Process(request, test.suggestions)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, suggestionIDs(processed))
+		})
+	}
+}
+
+func TestEditorialRulesProcessor_ConceptURIs(t *testing.T) {
+	path, remove := writeEditorialRules(t, `
+rules:
+  - name: a-with-b
+    suppress: [http://www.ft.com/thing/a]
+    when:
+      present: [http://api.ft.com/things/b]
+`)
+	defer remove()
+	rules, err := LoadEditorialRules(path, logger.NewUPPLogger("test-service", "panic"))
+	assert.NoError(t, err)
+	assert.Equal(t, []EditorialRule{{Name: "a-with-b", Suppress: []string{"a"}, When: EditorialCondition{Present: []string{"b"}}}}, rules.Rules())
+
+	request := newProcessingRequest()
+	request.Suggesters = []Suggester{&staticSuggester{}}
+	processed, err := (&EditorialRulesProcessor{Rules: rules}).Process(request, map[int][]Suggestion{0: {
+		{Concept: Concept{ID: "http://www.ft.com/thing/a"}},
+		{Concept: Concept{ID: "http://www.ft.com/thing/b"}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[int][]string{0: {"http://www.ft.com/thing/b"}}, suggestionIDs(processed))
+}
+
+func TestEditorialRulesProcessor_AddedConcept(t *testing.T) {
+	request := newProcessingRequest()
+	request.Suggesters = []Suggester{&staticSuggester{}}
+	request.Content = ContentAttributes{Byline: "Lex"}
+
+	processed, err := (&EditorialRulesProcessor{Rules: loadTestEditorialRules(t)}).Process(request, map[int][]Suggestion{0: {}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[int][]Suggestion{0: {{
+		Concept:   Concept{ID: "http://www.ft.com/thing/lex", Type: "http://www.ft.com/ontology/product/Brand", PrefLabel: "Lex"},
+		Predicate: "http://www.ft.com/ontology/classification/isClassifiedBy",
+	}}}, processed)
+}
+
+func TestEditorialRulesProcessor_NoRules(t *testing.T) {
+	suggestions := map[int][]Suggestion{0: {{Concept: Concept{ID: "http://www.ft.com/thing/a"}}}}
+	processed, err := (&EditorialRulesProcessor{}).Process(newProcessingRequest(), suggestions)
+	assert.NoError(t, err)
+	assert.Equal(t, suggestions, processed)
+}
+
+func TestLoadEditorialRules_InvalidRules(t *testing.T) {
+	tests := map[string]string{
+		"rules:\n  - suppress: [a]\n":                                          "editorial rule 1 has no name",
+		"rules:\n  - name: empty\n":                                            `editorial rule "empty" neither suppresses nor adds concepts`,
+		"rules:\n  - name: add\n    add:\n      - prefLabel: Lex\n":            `editorial rule "add" adds a concept without id`,
+		"rules:\n  - {name: a, suppress: [a]}\n  - {name: a, suppress: [b]}\n": `editorial rule "a" is defined more than once`,
+	}
+	for rules, expected := range tests {
+		path, remove := writeEditorialRules(t, rules)
+		_, err := LoadEditorialRules(path, logger.NewUPPLogger("test-service", "panic"))
+		remove()
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestEditorialRules_Reload(t *testing.T) {
+	expect := assert.New(t)
+
+	path, remove := writeEditorialRules(t, "rules:\n  - {name: a, suppress: [a]}\n")
+	defer remove()
+	rules, err := LoadEditorialRules(path, logger.NewUPPLogger("test-service", "panic"))
+	expect.NoError(err)
+	version := rules.Version()
+
+	reloaded, err := rules.Reload()
+	expect.NoError(err)
+	expect.False(reloaded)
+
+	expect.NoError(ioutil.WriteFile(path, []byte("rules:\n  - {name: b, suppress: [b]}\n"), 0600))
+	reloaded, err = rules.Reload()
+	expect.NoError(err)
+	expect.True(reloaded)
+	expect.Equal([]EditorialRule{{Name: "b", Suppress: []string{"b"}}}, rules.Rules())
+	expect.NotEqual(version, rules.Version())
+
+	// invalid changes keep the current rules
+	version = rules.Version()
+	expect.NoError(ioutil.WriteFile(path, []byte("rules:\n  - {name: c, unknown: [c]}\n"), 0600))
+	_, err = rules.Reload()
+	expect.Error(err)
+	expect.Equal([]EditorialRule{{Name: "b", Suppress: []string{"b"}}}, rules.Rules())
+	expect.Equal(version, rules.Version())
+}
+
+func TestAggregateSuggester_GetSuggestionsWithEditorialRules(t *testing.T) {
+	expect := assert.New(t)
+
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Test Suggestion API", response: locations("a", "b")})
+	defer closeServer()
+	suggester.Pipeline = append(DefaultPipeline(suggester.Concordance, suggester.BroaderProvider, suggester.Blacklister), &EditorialRulesProcessor{Rules: loadTestEditorialRules(t)})
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body", "byline": "<b>Lex</b>", "type": "Article"}`), "tid_test")
+	expect.NoError(err)
+	var ids []string
+	for _, suggestion := range response.Suggestions {
+		ids = append(ids, suggestion.ID)
+	}
+	expect.Equal([]string{"http://www.ft.com/thing/b", "http://www.ft.com/thing/lex"}, ids)
+}
+
+func TestAggregateSuggester_CachedResponsesInvalidatedByEditorialRules(t *testing.T) {
+	expect := assert.New(t)
+
+	path, remove := writeEditorialRules(t, "rules:\n  - {name: a, suppress: [a]}\n")
+	defer remove()
+	rules, err := LoadEditorialRules(path, logger.NewUPPLogger("test-service", "panic"))
+	expect.NoError(err)
+
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Test Suggestion API", response: locations("a", "b")})
+	defer closeServer()
+	suggester.Pipeline = append(DefaultPipeline(suggester.Concordance, suggester.BroaderProvider, suggester.Blacklister), &EditorialRulesProcessor{Rules: rules})
+	suggester.Cache = NewResponseCache(time.Hour, 10)
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal([]string{"http://www.ft.com/thing/b"}, suggestionIDs(map[int][]Suggestion{0: response.Suggestions})[0])
+
+	expect.NoError(ioutil.WriteFile(path, []byte("rules:\n  - {name: b, suppress: [b]}\n"), 0600))
+	_, err = rules.Reload()
+	expect.NoError(err)
+
+	response, err = suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal([]string{"http://www.ft.com/thing/a"}, suggestionIDs(map[int][]Suggestion{0: response.Suggestions})[0])
+}
+
+func TestEditorialRules_ReloadInBackgroundDisabled(t *testing.T) {
+	expect := assert.New(t)
+
+	path, remove := writeEditorialRules(t, "rules:\n  - {name: a, suppress: [a]}\n")
+	defer remove()
+	rules, err := LoadEditorialRules(path, logger.NewUPPLogger("test-service", "panic"))
+	expect.NoError(err)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		stop := rules.ReloadInBackground(interval)
+		stop()
+	}
+
+	expect.NoError(ioutil.WriteFile(path, []byte("rules:\n  - {name: b, suppress: [b]}\n"), 0600))
+	time.Sleep(20 * time.Millisecond)
+	expect.Equal([]EditorialRule{{Name: "a", Suppress: []string{"a"}}}, rules.Rules())
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const ControlVariant = "control"
+
+// Experiment routes a percentage of the content to an alternate set of suggesters, the rest of it staying on the control suggesters.
+// Routing is sticky, the same content ID always gets the same variant, and content without an ID always gets the control variant.
+type Experiment struct {
+	Name       string
+	Percentage int
+	Suggesters []Suggester
+}
+
+// variant tells whether the content with the given ID takes part in the experiment
+func (e *Experiment) variant(contentID string) string {
+	if e == nil || e.Percentage <= 0 || contentID == "" {
+		return ControlVariant
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(e.Name + ":" + contentID))
+	if int(hash.Sum32()%100) < e.Percentage {
+		return e.Name
+	}
+	return ControlVariant
+}
+
+// route picks the variant and the suggesters for the transformed payload
+func (s *AggregateSuggester) route(data []byte) (string, []Suggester) {
+	if s.Experiment == nil {
+		return "", s.Suggesters
+	}
+
+	var input JsonInput
+	// payloads which cannot be transformed go to the control suggesters
+	_ = json.Unmarshal(data, &input)
+
+	variant := s.Experiment.variant(input.Id)
+	metrics.GetOrRegisterCounter(fmt.Sprintf("suggest.variant.%s.requests", variant), metrics.DefaultRegistry).Inc(1)
+	if variant == ControlVariant {
+		return variant, s.Suggesters
+	}
+	return variant, s.Experiment.Suggesters
+}
+
+// FilteredSuggester changes the concept types kept from the suggestions of a suggester, e.g. to try other filter rules in an experiment
+type FilteredSuggester struct {
+	Suggester
+	ConceptTypes []string
+}
+
+// NewFilteredSuggester keeps the suggestions of the given concept types, the valid types being PseudoConceptTypeAuthor and the source params
+func NewFilteredSuggester(suggester Suggester, conceptTypes ...string) (*FilteredSuggester, error) {
+	for _, conceptType := range conceptTypes {
+		if _, found := typeValidators[conceptType]; !found {
+			return nil, fmt.Errorf("unknown concept type %q", conceptType)
+		}
+	}
+	return &FilteredSuggester{Suggester: suggester, ConceptTypes: conceptTypes}, nil
+}
+
+func (f *FilteredSuggester) FilterSuggestions(suggestions []Suggestion) []Suggestion {
+	return filterByConceptTypes(suggestions, f.ConceptTypes)
+}
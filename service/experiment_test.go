@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExperimentVariantIsStickyByContentID(t *testing.T) {
+	expect := assert.New(t)
+
+	experiment := &Experiment{Name: "new-model", Percentage: 30}
+
+	inExperiment := 0
+	for i := 0; i < 1000; i++ {
+		contentID := fmt.Sprintf("http://www.ft.com/thing/%d", i)
+		variant := experiment.variant(contentID)
+		expect.Equal(variant, experiment.variant(contentID))
+		if variant == "new-model" {
+			inExperiment++
+		}
+	}
+	expect.InDelta(300, inExperiment, 60)
+
+	expect.Equal(ControlVariant, experiment.variant(""))
+	expect.Equal(ControlVariant, (&Experiment{Name: "new-model"}).variant("http://www.ft.com/thing/1"))
+	expect.Equal("new-model", (&Experiment{Name: "new-model", Percentage: 100}).variant("http://www.ft.com/thing/1"))
+}
+
+func TestAggregateSuggester_GetSuggestionsRoutesToExperimentVariant(t *testing.T) {
+	expect := assert.New(t)
+
+	control := &staticSuggester{name: "Control Suggestion API", response: locations("a")}
+	alternate := &staticSuggester{name: "Alternate Suggestion API", response: locations("b", "c")}
+	suggester, closeServer := newTestAggregateSuggester(control)
+	defer closeServer()
+	suggester.Experiment = &Experiment{Name: "routing-test", Percentage: 100, Suggesters: []Suggester{alternate}}
+
+	requests := metrics.GetOrRegisterCounter("suggest.variant.routing-test.requests", metrics.DefaultRegistry).Count()
+
+	response, err := suggester.GetSuggestions([]byte(`{"id": "http://www.ft.com/content/1", "bodyXML": "Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal("routing-test", response.Variant)
+	expect.Len(response.Suggestions, 2)
+	expect.Equal(requests+1, metrics.GetOrRegisterCounter("suggest.variant.routing-test.requests", metrics.DefaultRegistry).Count())
+
+	response, err = suggester.GetSuggestions([]byte(`{"bodyXML": "Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal(ControlVariant, response.Variant)
+	expect.Len(response.Suggestions, 1)
+}
+
+func TestAggregateSuggester_GetSuggestionsWithoutExperimentHasNoVariant(t *testing.T) {
+	expect := assert.New(t)
+
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Control Suggestion API", response: locations("a")})
+	defer closeServer()
+
+	response, err := suggester.GetSuggestions([]byte(`{"id": "http://www.ft.com/content/1", "bodyXML": "Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal("", response.Variant)
+	expect.Len(response.Suggestions, 1)
+}
+
+func TestFilteredSuggester(t *testing.T) {
+	expect := assert.New(t)
+
+	suggestions := []Suggestion{
+		{Concept: Concept{ID: "location", Type: ontologyLocationType}},
+		{Concept: Concept{ID: "topic", Type: ontologyTopicType}},
+	}
+	filtered, err := NewFilteredSuggester(&staticSuggester{name: "Control Suggestion API"}, TopicSourceParam)
+	expect.NoError(err)
+	expect.Equal([]Suggestion{{Concept: Concept{ID: "topic", Type: ontologyTopicType}}}, filtered.FilterSuggestions(suggestions))
+	expect.Equal("Control Suggestion API", filtered.GetName())
+
+	_, err = NewFilteredSuggester(&staticSuggester{}, "unknownSource")
+	expect.EqualError(err, `unknown concept type "unknownSource"`)
+}
@@ -0,0 +1,73 @@
+package service_test
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/public-suggestions-api/service"
+	"github.com/Financial-Times/public-suggestions-api/stub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Each directory of testdata/golden is a test case, holding:
+//   - content.json: the suggestion request payload
+//   - downstream.yml: the responses of the downstream services, as ersatz fixtures
+//   - expected.json: the expected suggestions, regenerated with go test ./service -update
+var update = flag.Bool("update", false, "update the expected suggestions of the golden test cases")
+
+const goldenDir = "testdata/golden"
+
+func TestGoldenSuggestions(t *testing.T) {
+	cases, err := ioutil.ReadDir(goldenDir)
+	require.NoError(t, err)
+
+	for _, c := range cases {
+		if !c.IsDir() {
+			continue
+		}
+		dir := filepath.Join(goldenDir, c.Name())
+		t.Run(c.Name(), func(t *testing.T) {
+			runGoldenCase(t, dir)
+		})
+	}
+}
+
+func runGoldenCase(t *testing.T, dir string) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, "content.json"))
+	require.NoError(t, err)
+	fixtures, err := stub.LoadFixtures(filepath.Join(dir, "downstream.yml"))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(stub.NewHandler(fixtures))
+	defer server.Close()
+
+	client := &http.Client{}
+	suggester := service.NewAggregateSuggester(logger.NewUPPLogger("test", "PANIC"),
+		service.NewConcordance(server.URL, "/internalconcordances", client),
+		service.NewBroaderConceptsProvider(server.URL, "/things", client),
+		service.NewConceptBlacklister(server.URL, "/blacklist", client),
+		service.NewAuthorsSuggester(server.URL, "/content/suggest/authors", client),
+		service.NewOntotextSuggester(server.URL, "/content/suggest/ontotext", client))
+
+	response, err := suggester.GetSuggestions(content, "tid_golden")
+	require.NoError(t, err)
+	actual, err := json.MarshalIndent(response, "", "  ")
+	require.NoError(t, err)
+
+	expectedPath := filepath.Join(dir, "expected.json")
+	if *update {
+		require.NoError(t, ioutil.WriteFile(expectedPath, append(actual, '\n'), 0644))
+		return
+	}
+
+	expected, err := ioutil.ReadFile(expectedPath)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(actual))
+}
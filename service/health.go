@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// checkGTG calls the GTG endpoint of a downstream service, or of all its endpoints when its calls are balanced over several of them
+func checkGTG(name string, client Client, baseURL string, m *TrafficMonitor) (string, error) {
+	endpoints, err := gtgStatus(client, baseURL)
+	if err != nil {
+		return "", err
+	}
+	output, err := healthyWithTraffic(name, m)
+	if err != nil {
+		return "", err
+	}
+	if endpoints != "" {
+		output += ", " + endpoints
+	}
+	return output, nil
+}
+
+// gtgStatus calls the GTG endpoint at the given base URL, returning a summary of the endpoints when the client balances the calls to it
+func gtgStatus(client Client, baseURL string) (string, error) {
+	if balanced, ok := client.(*BalancedClient); ok && balanced.balances(baseURL) {
+		return balanced.CheckEndpoints("/__gtg")
+	}
+
+	req, err := http.NewRequest("GET", baseURL+"/__gtg", nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Add("User-Agent", "UPP public-suggestions-api")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Health check returned a non-200 HTTP status: %v", resp.StatusCode)
+	}
+	return "", nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const hedgingDelayRefreshPeriod = time.Second
+
+// HedgingPolicy configures hedged suggestion requests: when the first attempt has not answered within the hedging delay,
+// a second attempt is sent and the first successful answer wins, the other attempt being cancelled.
+type HedgingPolicy struct {
+	// Percentile of the recent latencies after which the second attempt is sent, e.g. 0.95
+	Percentile float64
+	// MinDelay is the minimum delay before the second attempt, also used until there were enough recent calls to compute the percentile
+	MinDelay time.Duration
+	// AlternateBaseURL receives the second attempt, which goes to the same base URL when empty
+	AlternateBaseURL string
+}
+
+type hedging struct {
+	policy HedgingPolicy
+	// primary records the latencies of the first attempts only, as those of the hedged requests would lower the delay and hedge ever more requests.
+	// The first attempts cancelled because the hedge won are not recorded either, as their latency is the one of the hedge.
+	primary    *TrafficMonitor
+	fired      metrics.Counter
+	won        metrics.Counter
+	mutex      sync.Mutex
+	delay      time.Duration
+	computedAt time.Time
+}
+
+type hedgedAttempt struct {
+	response SuggestionsResponse
+	err      error
+	hedge    bool
+}
+
+// HedgeRequests makes the suggester send a second attempt of the requests which are slower than the policy allows.
+// The hedging delay is computed from the recent latencies of the first attempts.
+func (suggester *SuggestionApi) HedgeRequests(policy HedgingPolicy) {
+	suggester.hedging = &hedging{
+		policy:  policy,
+		primary: NewTrafficMonitor(0, 0, 0),
+		fired:   metrics.GetOrRegisterCounter("downstream."+suggester.systemId+".hedges.fired", metrics.DefaultRegistry),
+		won:     metrics.GetOrRegisterCounter("downstream."+suggester.systemId+".hedges.won", metrics.DefaultRegistry),
+	}
+}
+
+func (suggester *SuggestionApi) getHedgedSuggestions(payload []byte, tid string) (SuggestionsResponse, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// cancels the slower attempt
+	defer cancel()
+
+	attempts := make(chan hedgedAttempt, 2)
+	attempt := func(baseURL string, hedge bool) {
+		start := time.Now()
+		response, err := suggester.getSuggestions(ctx, baseURL, payload, tid)
+		// the context is only cancelled once the other attempt won
+		if !hedge && ctx.Err() == nil {
+			suggester.hedging.primary.Record(time.Since(start), isDownstreamFailure(err))
+		}
+		attempts <- hedgedAttempt{response: response, err: err, hedge: hedge}
+	}
+	go attempt(suggester.apiBaseURL, false)
+
+	timer := time.NewTimer(suggester.hedging.currentDelay(suggester.hedging.primary))
+	defer timer.Stop()
+	select {
+	case first := <-attempts:
+		return first.response, first.err
+	case <-timer.C:
+	}
+
+	suggester.hedging.fired.Inc(1)
+	hedgeBaseURL := suggester.hedging.policy.AlternateBaseURL
+	if hedgeBaseURL == "" {
+		hedgeBaseURL = suggester.apiBaseURL
+	}
+	go attempt(hedgeBaseURL, true)
+
+	winner := <-attempts
+	if isDownstreamFailure(winner.err) {
+		// the other attempt might still succeed
+		if other := <-attempts; !isDownstreamFailure(other.err) {
+			winner = other
+		}
+	}
+	if winner.hedge {
+		suggester.hedging.won.Inc(1)
+	}
+	return winner.response, winner.err
+}
+
+// currentDelay is the configured percentile of the given recent latencies, computed at most once per refresh period
+func (h *hedging) currentDelay(traffic *TrafficMonitor) time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.computedAt) < hedgingDelayRefreshPeriod {
+		return h.delay
+	}
+	h.computedAt = now
+	h.delay = h.policy.MinDelay
+	if latency, ok := traffic.LatencyPercentile(h.policy.Percentile); ok && latency > h.delay {
+		h.delay = latency
+	}
+	return h.delay
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func hedgingCounts() (int64, int64) {
+	return metrics.GetOrRegisterCounter("downstream.ontotext-suggestion-api.hedges.fired", metrics.DefaultRegistry).Count(),
+		metrics.GetOrRegisterCounter("downstream.ontotext-suggestion-api.hedges.won", metrics.DefaultRegistry).Count()
+}
+
+func TestOntotextSuggester_HedgedRequestWins(t *testing.T) {
+	expect := assert.New(t)
+
+	var calls int32
+	cancelled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the cancellation of the request is only noticed once its body was read
+		ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(sampleJSONResponse))
+	}))
+	defer server.Close()
+
+	suggester := NewOntotextSuggester(server.URL, "/content/suggest/ontotext", http.DefaultClient)
+	suggester.HedgeRequests(HedgingPolicy{Percentile: 0.95, MinDelay: 20 * time.Millisecond})
+	fired, won := hedgingCounts()
+
+	response, err := suggester.GetSuggestions([]byte("{}"), "tid_test")
+	expect.NoError(err)
+	expect.Len(response.Suggestions, 2)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the slower attempt was not cancelled")
+	}
+	expect.Equal(int32(2), atomic.LoadInt32(&calls))
+	newFired, newWon := hedgingCounts()
+	expect.Equal(fired+1, newFired)
+	expect.Equal(won+1, newWon)
+}
+
+func TestOntotextSuggester_NoHedgeForFastAnswer(t *testing.T) {
+	expect := assert.New(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(sampleJSONResponse))
+	}))
+	defer server.Close()
+
+	suggester := NewOntotextSuggester(server.URL, "/content/suggest/ontotext", http.DefaultClient)
+	suggester.HedgeRequests(HedgingPolicy{Percentile: 0.95, MinDelay: time.Second})
+	fired, _ := hedgingCounts()
+
+	response, err := suggester.GetSuggestions([]byte("{}"), "tid_test")
+	expect.NoError(err)
+	expect.Len(response.Suggestions, 2)
+	expect.Equal(int32(1), atomic.LoadInt32(&calls))
+	newFired, _ := hedgingCounts()
+	expect.Equal(fired, newFired)
+}
+
+func TestOntotextSuggester_HedgeToAlternateEndpointAfterFailure(t *testing.T) {
+	expect := assert.New(t)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	alternate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(sampleJSONResponse))
+	}))
+	defer alternate.Close()
+
+	suggester := NewOntotextSuggester(primary.URL, "/content/suggest/ontotext", http.DefaultClient)
+	suggester.HedgeRequests(HedgingPolicy{Percentile: 0.95, MinDelay: 10 * time.Millisecond, AlternateBaseURL: alternate.URL})
+	_, won := hedgingCounts()
+
+	// the first attempt fails first, the answer of the hedge is awaited
+	response, err := suggester.GetSuggestions([]byte("{}"), "tid_test")
+	expect.NoError(err)
+	expect.Len(response.Suggestions, 2)
+	_, newWon := hedgingCounts()
+	expect.Equal(won+1, newWon)
+}
+
+func TestHedgingDelayFromRecentLatencies(t *testing.T) {
+	expect := assert.New(t)
+
+	monitor := NewTrafficMonitor(time.Minute, 0.5, 10)
+	h := &hedging{policy: HedgingPolicy{Percentile: 0.9, MinDelay: 50 * time.Millisecond}}
+
+	expect.Equal(50*time.Millisecond, h.currentDelay(monitor))
+
+	for i := 1; i <= 10; i++ {
+		monitor.Record(time.Duration(i)*100*time.Millisecond, false)
+	}
+	// the delay is only refreshed periodically
+	expect.Equal(50*time.Millisecond, h.currentDelay(monitor))
+	h.computedAt = time.Time{}
+	expect.Equal(900*time.Millisecond, h.currentDelay(monitor))
+}
+
+func TestOntotextSuggester_HedgingDelayIgnoresHedgedLatencies(t *testing.T) {
+	expect := assert.New(t)
+
+	var calls int32
+	cancelled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			// the first attempts are slow, until cancelled by the hedge
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(sampleJSONResponse))
+	}))
+	defer server.Close()
+
+	suggester := NewOntotextSuggester(server.URL, "/content/suggest/ontotext", http.DefaultClient)
+	suggester.HedgeRequests(HedgingPolicy{Percentile: 0.5, MinDelay: 50 * time.Millisecond})
+	traffic := NewTrafficMonitor(time.Minute, 0, 1)
+	suggester.MonitorTraffic(traffic)
+
+	_, err := suggester.GetSuggestions([]byte("{}"), "tid_test")
+	expect.NoError(err)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the slower attempt was not cancelled")
+	}
+	// leaves the cancelled first attempt the time to return
+	time.Sleep(50 * time.Millisecond)
+	expect.Equal(0, suggester.hedging.primary.Stats().Calls)
+	expect.Equal(1, traffic.Stats().Calls)
+}
+
+func TestOntotextSuggester_HedgingDelayRecordsFailedFirstAttempts(t *testing.T) {
+	expect := assert.New(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	suggester := NewOntotextSuggester(server.URL, "/content/suggest/ontotext", http.DefaultClient)
+	suggester.HedgeRequests(HedgingPolicy{Percentile: 0.5, MinDelay: 20 * time.Millisecond})
+
+	_, err := suggester.GetSuggestions([]byte("{}"), "tid_test")
+	expect.Error(err)
+
+	// the first attempt answered before the hedge, so it is recorded even though both attempts failed
+	primary := suggester.hedging.primary.Stats()
+	expect.Equal(1, primary.Calls)
+	expect.True(primary.P50 >= 100*time.Millisecond, "the first attempt was recorded with %v", primary.P50)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	fp "path/filepath"
+)
+
+type ImpliedSuggestions struct {
+	Suggestions []Suggestion     `json:"suggestions"`
+	Implied     []ImpliedConcept `json:"implied"`
+	// Incomplete tells that the implied concepts could not be looked up, the suggestions being returned without them
+	Incomplete bool `json:"incomplete,omitempty"`
+	// Variant is the experiment variant which served the suggestions, if any
+	Variant string `json:"-"`
+}
+
+// ImpliedConcept is a broader concept of some of the suggestions, which are listed by ImpliedBy
+type ImpliedConcept struct {
+	Concept
+	ImpliedBy []string `json:"impliedBy"`
+}
+
+// GetImpliedSuggestions aggregates suggestions for the given payload and adds their broader concepts as implied concepts, e.g. for navigation tagging.
+// Implied concepts are resolved to their canonical concepts using internal concordances, and the blacklisted or already suggested ones are left out.
+// They don't go through the processing stages of the suggestions, so neither the configured stages nor the editorial rules apply to them.
+// When public things or internal concordances fail, the suggestions are returned without implied concepts and marked as incomplete.
+func (s *AggregateSuggester) GetImpliedSuggestions(payload []byte, tid string) (ImpliedSuggestions, error) {
+	implied := ImpliedSuggestions{Implied: make([]ImpliedConcept, 0)}
+
+	suggestions, err := s.GetSuggestions(payload, tid)
+	if err != nil {
+		return implied, err
+	}
+	implied.Suggestions = suggestions.Suggestions
+	implied.Variant = suggestions.Variant
+
+	var ids []string
+	suggestedIDs := make(map[string]bool, len(suggestions.Suggestions))
+	for _, suggestion := range suggestions.Suggestions {
+		id := fp.Base(suggestion.ID)
+		ids = append(ids, id)
+		suggestedIDs[id] = true
+	}
+	ids = dedup(ids)
+	if len(ids) == 0 {
+		return implied, nil
+	}
+
+	broader, err := s.BroaderProvider.getBroaderConcepts(ids, tid)
+	if err != nil {
+		s.Log.WithTransactionID(tid).WithError(err).Warn("Couldn't look up the broader concepts of the suggestions, returning them without implied concepts")
+		implied.Incomplete = true
+		return implied, nil
+	}
+
+	// broader concepts in the order of the suggestions implying them
+	var broaderIDs []string
+	impliedBy := make(map[string][]string)
+	for _, suggestion := range suggestions.Suggestions {
+		thing, found := broader.Things[fp.Base(suggestion.ID)]
+		if !found {
+			continue
+		}
+		for _, broaderConcept := range thing.BroaderConcepts {
+			broaderID := fp.Base(broaderConcept.ID)
+			if _, found := impliedBy[broaderID]; !found {
+				broaderIDs = append(broaderIDs, broaderID)
+			}
+			impliedBy[broaderID] = appendUnique(impliedBy[broaderID], suggestion.ID)
+		}
+	}
+	if len(broaderIDs) == 0 {
+		return implied, nil
+	}
+
+	concorded, err := s.Concordance.getConcordances(broaderIDs, tid)
+	if err != nil {
+		s.Log.WithTransactionID(tid).WithError(err).Warn("Couldn't concord the implied concepts, returning the suggestions without them")
+		implied.Incomplete = true
+		return implied, nil
+	}
+
+	blacklist, err := s.Blacklister.GetBlacklist(tid)
+	if err != nil {
+		s.Log.WithTransactionID(tid).WithError(err).Errorf("Error retrieving concept blacklist, filtering disabled")
+	}
+
+	// equivalent broader IDs are merged into their canonical concept
+	indexes := make(map[string]int)
+	for _, broaderID := range broaderIDs {
+		concept, found := concorded.Concepts[broaderID]
+		if !found {
+			continue
+		}
+		id := fp.Base(concept.ID)
+		// implied concepts have neither predicate nor suggester, so only the entries scoped by type apply to them
+		if suggestedIDs[id] || s.Blacklister.IsBlacklistedIn(concept.ID, BlacklistScope{Type: concept.Type}, blacklist) {
+			continue
+		}
+		if index, found := indexes[id]; found {
+			for _, narrower := range impliedBy[broaderID] {
+				implied.Implied[index].ImpliedBy = appendUnique(implied.Implied[index].ImpliedBy, narrower)
+			}
+			continue
+		}
+		indexes[id] = len(implied.Implied)
+		implied.Implied = append(implied.Implied, ImpliedConcept{Concept: concept, ImpliedBy: impliedBy[broaderID]})
+	}
+	return implied, nil
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
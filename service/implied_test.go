@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateSuggester_GetImpliedSuggestions(t *testing.T) {
+	expect := assert.New(t)
+
+	concept := func(id string, label string, conceptType string) Concept {
+		return Concept{ID: "http://www.ft.com/thing/" + id, PrefLabel: label, Type: conceptType}
+	}
+	concepts := map[string]Concept{
+		"paris":     concept("paris", "Paris", ontologyLocationType),
+		"france":    concept("france", "France", ontologyLocationType),
+		"europe":    concept("europe", "Europe", ontologyLocationType),
+		"inflation": concept("inflation", "Inflation", ontologyTopicType),
+		"economics": concept("economics", "Economics", ontologyTopicType),
+		"banned":    concept("banned", "Banned", ontologyTopicType),
+	}
+	broader := func(ids ...string) Thing {
+		var thing Thing
+		for _, id := range ids {
+			thing.BroaderConcepts = append(thing.BroaderConcepts, BroaderConcept{ID: "http://www.ft.com/thing/" + id})
+		}
+		return thing
+	}
+	things := map[string]Thing{
+		"paris":     broader("france", "europe"),
+		"france":    broader("europe"),
+		"inflation": broader("economics", "banned", "unconcorded"),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/internalconcordances":
+			response := ConcordanceResponse{Concepts: map[string]Concept{}}
+			for _, id := range r.URL.Query()["ids"] {
+				if c, found := concepts[id]; found {
+					response.Concepts[id] = c
+				}
+			}
+			json.NewEncoder(w).Encode(response)
+		case "/things":
+			response := broaderResponse{Things: map[string]Thing{}}
+			for _, id := range r.URL.Query()["uuid"] {
+				if thing, found := things[id]; found {
+					response.Things[id] = thing
+				}
+			}
+			json.NewEncoder(w).Encode(response)
+		case "/blacklist":
+			w.Write([]byte(`{"uuids": ["banned"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	suggester := NewAggregateSuggester(logger.NewUPPLogger("test-service", "panic"),
+		NewConcordance(server.URL, "/internalconcordances", http.DefaultClient),
+		NewBroaderConceptsProvider(server.URL, "/things", http.DefaultClient),
+		NewConceptBlacklister(server.URL, "/blacklist", http.DefaultClient),
+		&staticSuggester{name: "Test Suggestion API", response: SuggestionsResponse{Suggestions: []Suggestion{
+			{Concept: concepts["paris"]}, {Concept: concepts["france"]}, {Concept: concepts["inflation"]},
+		}}})
+
+	response, err := suggester.GetImpliedSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	// France is excluded from the suggestions as a broader concept of Paris
+	expect.Equal([]Suggestion{{Concept: concepts["paris"]}, {Concept: concepts["inflation"]}}, response.Suggestions)
+	expect.Equal([]ImpliedConcept{
+		{Concept: concepts["france"], ImpliedBy: []string{"http://www.ft.com/thing/paris"}},
+		{Concept: concepts["europe"], ImpliedBy: []string{"http://www.ft.com/thing/paris"}},
+		{Concept: concepts["economics"], ImpliedBy: []string{"http://www.ft.com/thing/inflation"}},
+	}, response.Implied)
+}
+
+func TestAggregateSuggester_GetImpliedSuggestionsWithoutSuggestions(t *testing.T) {
+	expect := assert.New(t)
+
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Test Suggestion API", response: SuggestionsResponse{Suggestions: []Suggestion{}}})
+	defer closeServer()
+
+	response, err := suggester.GetImpliedSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Empty(response.Suggestions)
+	expect.Equal([]ImpliedConcept{}, response.Implied)
+}
+
+func TestAggregateSuggester_GetImpliedSuggestionsPublicThingsUnavailable(t *testing.T) {
+	expect := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Test Suggestion API", response: locations("a")})
+	defer closeServer()
+	suggester.BroaderProvider = NewBroaderConceptsProvider(server.URL, "/things", http.DefaultClient)
+
+	response, err := suggester.GetImpliedSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	if expect.Len(response.Suggestions, 1) {
+		expect.Equal("http://www.ft.com/thing/a", response.Suggestions[0].ID)
+	}
+	expect.Equal([]ImpliedConcept{}, response.Implied)
+	expect.True(response.Incomplete)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+var ResponseTooLargeError = errors.New("response exceeded the maximum allowed size")
+
+// LimitedReadCloser reads at most N bytes from the underlying ReadCloser.
+// Reading past the limit returns Err, and calls OnExceeded once if set.
+type LimitedReadCloser struct {
+	io.ReadCloser
+	N          int64
+	Err        error
+	OnExceeded func()
+	exceeded   bool
+}
+
+func (l *LimitedReadCloser) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, l.Err
+	}
+	// read one byte more than allowed, so that hitting the limit exactly is not reported as an error
+	if int64(len(p)) > l.N+1 {
+		p = p[:l.N+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) > l.N {
+		n = int(l.N)
+		l.N = 0
+		l.exceeded = true
+		if l.OnExceeded != nil {
+			l.OnExceeded()
+		}
+		return n, l.Err
+	}
+	l.N -= int64(n)
+	return n, err
+}
+
+// SizeLimitedClient rejects downstream responses bigger than the configured maximum size, instead of reading them whole into memory.
+type SizeLimitedClient struct {
+	client   Client
+	name     string
+	maxSize  int64
+	rejected metrics.Counter
+}
+
+func NewSizeLimitedClient(name string, client Client, maxSize int64) *SizeLimitedClient {
+	return &SizeLimitedClient{
+		client:   client,
+		name:     name,
+		maxSize:  maxSize,
+		rejected: metrics.GetOrRegisterCounter(fmt.Sprintf("downstream.%s.oversize", name), metrics.DefaultRegistry),
+	}
+}
+
+func (c *SizeLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil || c.maxSize <= 0 {
+		return resp, err
+	}
+
+	tooLargeErr := fmt.Errorf("%v: %w", c.name, ResponseTooLargeError)
+	if resp.ContentLength > c.maxSize {
+		resp.Body.Close()
+		c.rejected.Inc(1)
+		return nil, tooLargeErr
+	}
+
+	resp.Body = &LimitedReadCloser{
+		ReadCloser: resp.Body,
+		N:          c.maxSize,
+		Err:        tooLargeErr,
+		OnExceeded: func() { c.rejected.Inc(1) },
+	}
+	return resp, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLimitedReadCloser_ReadWithinLimit(t *testing.T) {
+	expect := assert.New(t)
+
+	exceeded := false
+	reader := &LimitedReadCloser{
+		ReadCloser: ioutil.NopCloser(strings.NewReader("0123456789")),
+		N:          10,
+		Err:        ResponseTooLargeError,
+		OnExceeded: func() { exceeded = true },
+	}
+	body, err := ioutil.ReadAll(reader)
+
+	expect.NoError(err)
+	expect.Equal("0123456789", string(body))
+	expect.False(exceeded)
+}
+
+func TestLimitedReadCloser_ReadOverLimit(t *testing.T) {
+	expect := assert.New(t)
+
+	exceeded := 0
+	reader := &LimitedReadCloser{
+		ReadCloser: ioutil.NopCloser(strings.NewReader("0123456789")),
+		N:          9,
+		Err:        ResponseTooLargeError,
+		OnExceeded: func() { exceeded++ },
+	}
+	body, err := ioutil.ReadAll(reader)
+
+	expect.True(errors.Is(err, ResponseTooLargeError))
+	expect.Equal("012345678", string(body))
+	_, err = reader.Read(make([]byte, 10))
+	expect.True(errors.Is(err, ResponseTooLargeError))
+	expect.Equal(1, exceeded)
+}
+
+func TestSizeLimitedClient_RejectsByContentLength(t *testing.T) {
+	expect := assert.New(t)
+
+	mockClient := new(mockHttpClient)
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:          ioutil.NopCloser(strings.NewReader(`{"uuids":[]}`)),
+		ContentLength: 12,
+		StatusCode:    http.StatusOK,
+	}, nil)
+
+	client := NewSizeLimitedClient("test-limited-content-length", mockClient, 11)
+	rejectedBefore := client.rejected.Count()
+	req, _ := http.NewRequest("GET", "http://test-url", nil)
+	resp, err := client.Do(req)
+
+	expect.Nil(resp)
+	expect.True(errors.Is(err, ResponseTooLargeError))
+	expect.Equal("test-limited-content-length: response exceeded the maximum allowed size", err.Error())
+	expect.Equal(rejectedBefore+1, client.rejected.Count())
+}
+
+func TestSizeLimitedClient_RejectsWhileReading(t *testing.T) {
+	expect := assert.New(t)
+
+	mockClient := new(mockHttpClient)
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:          ioutil.NopCloser(strings.NewReader(`{"uuids":["f758ef56-c40a-3162-91aa-3e8a3aabc495"]}`)),
+		ContentLength: -1,
+		StatusCode:    http.StatusOK,
+	}, nil)
+
+	blacklister := NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", NewSizeLimitedClient("test-limited-streaming", mockClient, 16))
+	_, err := blacklister.GetBlacklist("tid_test")
+
+	expect.True(errors.Is(err, ResponseTooLargeError))
+}
+
+func TestSizeLimitedClient_NoLimit(t *testing.T) {
+	expect := assert.New(t)
+
+	mockClient := new(mockHttpClient)
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:          ioutil.NopCloser(strings.NewReader(`{"uuids":["f758ef56-c40a-3162-91aa-3e8a3aabc495"]}`)),
+		ContentLength: -1,
+		StatusCode:    http.StatusOK,
+	}, nil)
+
+	blacklister := NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", NewSizeLimitedClient("test-unlimited", mockClient, 0))
+	blacklist, err := blacklister.GetBlacklist("tid_test")
+
+	expect.NoError(err)
+	expect.Equal([]string{"f758ef56-c40a-3162-91aa-3e8a3aabc495"}, blacklist.UUIDS)
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+const (
+	ConcordanceStage      = "concordance"
+	ConceptTypesStage     = "concept-types"
+	BroaderExclusionStage = "broader-exclusion"
+	BlacklistStage        = "blacklist"
+	EditorialRulesStage   = "editorial-rules"
+)
+
+// SuggestionProcessor is a post-processing stage of the suggestions, which are keyed by the index of the suggester which suggested them.
+type SuggestionProcessor interface {
+	// Name identifies the stage in the logs and in the configuration of the pipeline
+	Name() string
+	// Process returns the processed suggestions, an error failing the whole request.
+	// Stages which can do without a downstream service should rather log its failure and mark the request as incomplete.
+	Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error)
+}
+
+// SuggestionPrefetcher is implemented by the stages which look up data for the suggested concepts before processing them.
+// The lookups of all the stages start with the pipeline, so they run concurrently with the previous stages,
+// and their results are available to Process through ProcessingRequest.Prefetched.
+type SuggestionPrefetcher interface {
+	SuggestionProcessor
+	Prefetch(request *ProcessingRequest, suggestions map[int][]Suggestion) (interface{}, error)
+}
+
+// VersionedProcessor is implemented by the stages whose processing depends on data changing over time, e.g. rules reloaded from a file
+type VersionedProcessor interface {
+	SuggestionProcessor
+	Version() string
+}
+
+// ProcessingRequest holds the state of a suggestion request going through the pipeline
+type ProcessingRequest struct {
+	TID string
+	Log *logger.LogEntry
+	// Suggesters are the suggesters of the request, in the order of the indexes of the suggestions
+	Suggesters []Suggester
+	// Blacklist is empty when it could not be retrieved
+	Blacklist Blacklist
+	// Content holds the attributes of the content which are not sent to the suggesters
+	Content    ContentAttributes
+	incomplete bool
+	stage      int
+	prefetches map[int]*prefetch
+}
+
+type prefetch struct {
+	done   chan struct{}
+	result interface{}
+	err    error
+}
+
+// MarkIncomplete tells that a stage could not process the suggestions completely, so the response is not cached
+func (r *ProcessingRequest) MarkIncomplete() {
+	r.incomplete = true
+}
+
+// Prefetched waits for the result of the lookup of the current stage, which must implement SuggestionPrefetcher
+func (r *ProcessingRequest) Prefetched() (interface{}, error) {
+	p, found := r.prefetches[r.stage]
+	if !found {
+		return nil, fmt.Errorf("stage %d did not prefetch anything", r.stage)
+	}
+	<-p.done
+	return p.result, p.err
+}
+
+// Pipeline is an ordered list of post-processing stages
+type Pipeline []SuggestionProcessor
+
+// NewPipeline builds the pipeline running the named stages in the given order, out of the available stages.
+// Without names the pipeline is empty and returns the suggestions as they are.
+func NewPipeline(names []string, available ...SuggestionProcessor) (Pipeline, error) {
+	stages := make(map[string]SuggestionProcessor, len(available))
+	for _, stage := range available {
+		stages[stage.Name()] = stage
+	}
+
+	// not nil, as the aggregator falls back to the default pipeline when none is configured
+	pipeline := Pipeline{}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		stage, found := stages[name]
+		if !found {
+			return nil, fmt.Errorf("unknown processing stage %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("processing stage %q is listed more than once", name)
+		}
+		seen[name] = true
+		pipeline = append(pipeline, stage)
+	}
+	return pipeline, nil
+}
+
+// DefaultPipeline concords the suggestions, keeps the concept types targeted by each suggester,
+// and then excludes the broader concepts of other suggestions and the blacklisted concepts
+func DefaultPipeline(concordance *ConcordanceService, broaderProvider *BroaderConceptsProvider, blacklister ConceptBlacklister) Pipeline {
+	return Pipeline{
+		&ConcordanceProcessor{Concordance: concordance},
+		&ConceptTypesProcessor{},
+		&BroaderExclusionProcessor{Provider: broaderProvider},
+		&BlacklistProcessor{Blacklister: blacklister},
+	}
+}
+
+// Version identifies the data of the versioned stages, so that the responses processed with other data are not served from the response cache
+func (p Pipeline) Version() string {
+	var versions []string
+	for _, stage := range p {
+		if versioned, ok := stage.(VersionedProcessor); ok {
+			versions = append(versions, versioned.Version())
+		}
+	}
+	return strings.Join(versions, ",")
+}
+
+// Run processes the suggestions through all the stages in order, after starting the lookups of the prefetching stages
+func (p Pipeline) Run(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	request.prefetches = make(map[int]*prefetch)
+	var wg sync.WaitGroup
+	for i, stage := range p {
+		prefetcher, ok := stage.(SuggestionPrefetcher)
+		if !ok {
+			continue
+		}
+		pending := &prefetch{done: make(chan struct{})}
+		request.prefetches[i] = pending
+		wg.Add(1)
+		go func(suggestions map[int][]Suggestion) {
+			defer wg.Done()
+			defer close(pending.done)
+			pending.result, pending.err = prefetcher.Prefetch(request, suggestions)
+		}(suggestions)
+	}
+	// no lookup outlives the request
+	defer wg.Wait()
+
+	var err error
+	for i, stage := range p {
+		request.stage = i
+		suggestions, err = stage.Process(request, suggestions)
+		if err != nil {
+			request.Log.WithError(err).Errorf("Processing stage %s failed", stage.Name())
+			return suggestions, err
+		}
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// dropProcessor drops the given concept IDs
+type dropProcessor struct {
+	name string
+	ids  map[string]bool
+	err  error
+}
+
+func (p *dropProcessor) Name() string {
+	return p.name
+}
+
+func (p *dropProcessor) Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	filtered := make(map[int][]Suggestion, len(suggestions))
+	for key, sourceSuggestions := range suggestions {
+		filtered[key] = []Suggestion{}
+		for _, suggestion := range sourceSuggestions {
+			if !p.ids[suggestion.ID] {
+				filtered[key] = append(filtered[key], suggestion)
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// barrierPrefetcher only completes its lookup once the stage before it processed the suggestions
+type barrierPrefetcher struct {
+	processed chan struct{}
+}
+
+func (p *barrierPrefetcher) Name() string {
+	return "barrier"
+}
+
+func (p *barrierPrefetcher) Prefetch(request *ProcessingRequest, suggestions map[int][]Suggestion) (interface{}, error) {
+	select {
+	case <-p.processed:
+		return len(suggestions[0]), nil
+	case <-time.After(2 * time.Second):
+		return nil, errors.New("previous stage did not run while prefetching")
+	}
+}
+
+func (p *barrierPrefetcher) Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	count, err := request.Prefetched()
+	if err != nil {
+		return nil, err
+	}
+	// the lookup got the suggestions the pipeline started with
+	if count.(int) != 2 {
+		return nil, errors.New("unexpected prefetched suggestions")
+	}
+	return suggestions, nil
+}
+
+type signalProcessor struct {
+	processed chan struct{}
+}
+
+func (p *signalProcessor) Name() string {
+	return "signal"
+}
+
+func (p *signalProcessor) Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	close(p.processed)
+	return suggestions, nil
+}
+
+func newProcessingRequest() *ProcessingRequest {
+	return &ProcessingRequest{TID: "tid_test", Log: logger.NewUPPLogger("test-service", "panic").WithTransactionID("tid_test")}
+}
+
+func TestNewPipeline_StagesInConfiguredOrder(t *testing.T) {
+	expect := assert.New(t)
+
+	first := &dropProcessor{name: "first"}
+	second := &dropProcessor{name: "second"}
+	third := &dropProcessor{name: "third"}
+
+	pipeline, err := NewPipeline([]string{"third", "first"}, first, second, third)
+	expect.NoError(err)
+	expect.Equal(Pipeline{third, first}, pipeline)
+}
+
+func TestNewPipeline_UnknownStage(t *testing.T) {
+	_, err := NewPipeline([]string{"first", "unknown"}, &dropProcessor{name: "first"})
+	assert.EqualError(t, err, `unknown processing stage "unknown"`)
+}
+
+func TestNewPipeline_DuplicateStage(t *testing.T) {
+	_, err := NewPipeline([]string{"first", "first"}, &dropProcessor{name: "first"})
+	assert.EqualError(t, err, `processing stage "first" is listed more than once`)
+}
+
+func TestNewPipeline_DefaultStages(t *testing.T) {
+	expect := assert.New(t)
+
+	pipeline, err := NewPipeline([]string{BlacklistStage, ConcordanceStage, BroaderExclusionStage, ConceptTypesStage}, DefaultPipeline(nil, nil, nil)...)
+	expect.NoError(err)
+	var names []string
+	for _, stage := range pipeline {
+		names = append(names, stage.Name())
+	}
+	expect.Equal([]string{"blacklist", "concordance", "broader-exclusion", "concept-types"}, names)
+}
+
+func TestPipeline_RunStagesInOrder(t *testing.T) {
+	expect := assert.New(t)
+
+	pipeline := Pipeline{
+		&dropProcessor{name: "first", ids: map[string]bool{"a": true}},
+		&dropProcessor{name: "second", ids: map[string]bool{"c": true}},
+	}
+	suggestions := map[int][]Suggestion{
+		0: {{Concept: Concept{ID: "a"}}, {Concept: Concept{ID: "b"}}},
+		1: {{Concept: Concept{ID: "c"}}},
+	}
+
+	processed, err := pipeline.Run(newProcessingRequest(), suggestions)
+	expect.NoError(err)
+	expect.Equal(map[int][]Suggestion{0: {{Concept: Concept{ID: "b"}}}, 1: {}}, processed)
+}
+
+func TestPipeline_RunStopsOnStageError(t *testing.T) {
+	expect := assert.New(t)
+
+	last := &signalProcessor{processed: make(chan struct{})}
+	pipeline := Pipeline{&dropProcessor{name: "failing", err: errors.New("stage failed")}, last}
+
+	_, err := pipeline.Run(newProcessingRequest(), map[int][]Suggestion{0: {}})
+	expect.EqualError(err, "stage failed")
+	select {
+	case <-last.processed:
+		expect.Fail("stage after the failing one should not run")
+	default:
+	}
+}
+
+func TestPipeline_RunPrefetchesWhilePreviousStagesRun(t *testing.T) {
+	expect := assert.New(t)
+
+	processed := make(chan struct{})
+	pipeline := Pipeline{
+		&signalProcessor{processed: processed},
+		&barrierPrefetcher{processed: processed},
+	}
+	suggestions := map[int][]Suggestion{0: {{Concept: Concept{ID: "a"}}, {Concept: Concept{ID: "b"}}}}
+
+	processedSuggestions, err := pipeline.Run(newProcessingRequest(), suggestions)
+	expect.NoError(err)
+	expect.Equal(suggestions, processedSuggestions)
+}
+
+func TestAggregateSuggester_GetSuggestionsWithCustomPipeline(t *testing.T) {
+	expect := assert.New(t)
+
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Test Suggestion API", response: locations("a", "b", "c")})
+	defer closeServer()
+	pipeline, err := NewPipeline([]string{ConcordanceStage, "drop"},
+		append(DefaultPipeline(suggester.Concordance, suggester.BroaderProvider, suggester.Blacklister),
+			&dropProcessor{name: "drop", ids: map[string]bool{"http://www.ft.com/thing/b": true}})...)
+	expect.NoError(err)
+	suggester.Pipeline = pipeline
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	var ids []string
+	for _, suggestion := range response.Suggestions {
+		ids = append(ids, suggestion.ID)
+	}
+	expect.Equal([]string{"http://www.ft.com/thing/a", "http://www.ft.com/thing/c"}, ids)
+}
+
+func TestAggregateSuggester_GetSuggestionsWithoutProcessingStages(t *testing.T) {
+	expect := assert.New(t)
+
+	pipeline, err := NewPipeline(nil, DefaultPipeline(nil, nil, nil)...)
+	expect.NoError(err)
+	expect.NotNil(pipeline)
+
+	suggestions := SuggestionsResponse{Suggestions: []Suggestion{{Concept: Concept{ID: "http://www.ft.com/thing/unknown-to-concordances", Type: ontologyLocationType}}}}
+	suggester, closeServer := newTestAggregateSuggester(&staticSuggester{name: "Test Suggestion API", response: suggestions})
+	defer closeServer()
+	suggester.Pipeline = pipeline
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	expect.Equal(suggestions.Suggestions, response.Suggestions)
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	PrimaryRegion   = "primary"
+	SecondaryRegion = "secondary"
+)
+
+// regionFailover sends the concordance requests to the active region, switching to the other region when a request fails or times out.
+// Requests rejected by the active region are not sent to the other one.
+type regionFailover struct {
+	secondaryBaseURL string
+	timeout          time.Duration
+	mutex            sync.RWMutex
+	active           string
+	failovers        metrics.Counter
+}
+
+// FailoverTo makes the concordance requests fail over to the secondary region when they fail or take longer than the timeout in the active region.
+// The health check reports the active region and switches back to the primary region once it is healthy again.
+func (concordance *ConcordanceService) FailoverTo(secondaryBaseURL string, timeout time.Duration) {
+	concordance.regions = &regionFailover{
+		secondaryBaseURL: secondaryBaseURL,
+		timeout:          timeout,
+		active:           PrimaryRegion,
+		failovers:        metrics.GetOrRegisterCounter("downstream."+concordance.systemId+".region-failovers", metrics.DefaultRegistry),
+	}
+}
+
+// ActiveRegion is the region receiving the concordance requests
+func (concordance *ConcordanceService) ActiveRegion() string {
+	if concordance.regions == nil {
+		return PrimaryRegion
+	}
+	concordance.regions.mutex.RLock()
+	defer concordance.regions.mutex.RUnlock()
+	return concordance.regions.active
+}
+
+func (concordance *ConcordanceService) fetchFromActiveRegion(ids []string, tid string) (ConcordanceResponse, error) {
+	if concordance.regions == nil {
+		return concordance.fetchConcordances(context.Background(), concordance.ConcordanceBaseURL, ids, tid)
+	}
+
+	active := concordance.ActiveRegion()
+	concorded, err := concordance.fetchFromRegion(active, ids, tid)
+	// a rejected request would be rejected by the other region too
+	if !isConcordanceFailure(err) {
+		return concorded, err
+	}
+
+	other := otherRegion(active)
+	concorded, otherErr := concordance.fetchFromRegion(other, ids, tid)
+	if otherErr != nil {
+		return concorded, fmt.Errorf("%s region failed: %v, %s region failed: %w", active, err, other, otherErr)
+	}
+	concordance.activateRegion(other)
+	return concorded, nil
+}
+
+func (concordance *ConcordanceService) fetchFromRegion(region string, ids []string, tid string) (ConcordanceResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), concordance.regions.timeout)
+	defer cancel()
+	return concordance.fetchConcordances(ctx, concordance.regionBaseURL(region), ids, tid)
+}
+
+func (concordance *ConcordanceService) activateRegion(region string) {
+	concordance.regions.mutex.Lock()
+	defer concordance.regions.mutex.Unlock()
+	if concordance.regions.active != region {
+		concordance.regions.active = region
+		concordance.regions.failovers.Inc(1)
+	}
+}
+
+func (concordance *ConcordanceService) regionBaseURL(region string) string {
+	if region == SecondaryRegion {
+		return concordance.regions.secondaryBaseURL
+	}
+	return concordance.ConcordanceBaseURL
+}
+
+// checkRegions calls the GTG endpoint of both regions, failing only when none of them is healthy.
+// The primary region is activated whenever it is healthy, the secondary region when the primary one is not.
+func (concordance *ConcordanceService) checkRegions() (string, error) {
+	primaryEndpoints, primaryErr := gtgStatus(concordance.Client, concordance.ConcordanceBaseURL)
+	_, secondaryErr := gtgStatus(concordance.Client, concordance.regions.secondaryBaseURL)
+	if primaryErr != nil && secondaryErr != nil {
+		return "", fmt.Errorf("Both regions are unavailable, %s region: %v, %s region: %v", PrimaryRegion, primaryErr, SecondaryRegion, secondaryErr)
+	}
+
+	if primaryErr == nil {
+		concordance.activateRegion(PrimaryRegion)
+	} else {
+		concordance.activateRegion(SecondaryRegion)
+	}
+
+	output, err := healthyWithTraffic(concordance.name, concordance.traffic)
+	if err != nil {
+		return "", err
+	}
+	active := concordance.ActiveRegion()
+	output += fmt.Sprintf(", active region: %s (%s)", active, concordance.regionBaseURL(active))
+	if primaryEndpoints != "" {
+		output += fmt.Sprintf(", %s region %s", PrimaryRegion, primaryEndpoints)
+	}
+	if primaryErr != nil {
+		output += fmt.Sprintf(", %s region unavailable: %v", PrimaryRegion, primaryErr)
+	}
+	if secondaryErr != nil {
+		output += fmt.Sprintf(", %s region unavailable: %v", SecondaryRegion, secondaryErr)
+	}
+	return output, nil
+}
+
+func otherRegion(region string) string {
+	if region == PrimaryRegion {
+		return SecondaryRegion
+	}
+	return PrimaryRegion
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	fp "path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// shadowComparison is the comparison of the suggestions of a shadow suggester with the returned ones.
+// Precision is the share of the shadow suggestions that were returned, overlap the share of the returned suggestions that the shadow suggested too,
+// both considering only the concept types targeted by the shadow suggester.
+type shadowComparison struct {
+	Shadow    int
+	Primary   int
+	Common    int
+	Precision float64
+	Overlap   float64
+}
+
+// primaryResult is the returned response along with the request its suggestions were processed for
+type primaryResult struct {
+	response SuggestionsResponse
+	request  *ProcessingRequest
+}
+
+// runShadows calls the shadow suggesters in the background and compares their suggestions with the response sent on the returned channel.
+// Closing the channel without sending a response, e.g. on errors, skips the comparison.
+func (s *AggregateSuggester) runShadows(data []byte, pipeline Pipeline, tid string) chan<- primaryResult {
+	primary := make(chan primaryResult, 1)
+	if len(s.Shadows) == 0 {
+		return primary
+	}
+
+	s.shadows.Add(1)
+	go func() {
+		defer s.shadows.Done()
+		logEntry := s.Log.WithTransactionID(tid)
+
+		var responseMap = map[int][]Suggestion{}
+		var mutex = sync.Mutex{}
+		var wg = sync.WaitGroup{}
+		for key, shadow := range s.Shadows {
+			wg.Add(1)
+			go func(i int, shadow Suggester) {
+				defer wg.Done()
+				resp, err := shadow.GetSuggestions(data, tid)
+				if isDownstreamFailure(err) {
+					logEntry.WithError(err).Warnf("error calling shadow suggester %s", shadow.GetName())
+					metrics.GetOrRegisterCounter(shadowMetric(shadow, "errors"), metrics.DefaultRegistry).Inc(1)
+				}
+				mutex.Lock()
+				responseMap[i] = resp.Suggestions
+				mutex.Unlock()
+			}(key, shadow)
+		}
+		wg.Wait()
+
+		result, ok := <-primary
+		if !ok {
+			return
+		}
+		s.compareShadows(pipeline, responseMap, result)
+	}()
+	return primary
+}
+
+// compareShadows runs the suggestions of the shadow suggesters through the processing stages of the primary ones,
+// with the same blacklist and content, and compares them with the returned response.
+// Shadow suggestions are only logged and measured, they are never returned.
+func (s *AggregateSuggester) compareShadows(pipeline Pipeline, responseMap map[int][]Suggestion, primary primaryResult) {
+	logEntry := primary.request.Log
+
+	request := &ProcessingRequest{TID: primary.request.TID, Log: logEntry, Suggesters: s.Shadows, Blacklist: primary.request.Blacklist, Content: primary.request.Content}
+	responseMap, err := pipeline.Run(request, responseMap)
+	if err != nil {
+		logEntry.WithError(err).Warn("Couldn't process shadow suggestions, skipping their comparison")
+		return
+	}
+
+	for i, shadow := range s.Shadows {
+		comparison := compareSuggestions(responseMap[i], shadow.FilterSuggestions(primary.response.Suggestions))
+
+		metrics.GetOrRegisterCounter(shadowMetric(shadow, "calls"), metrics.DefaultRegistry).Inc(1)
+		metrics.GetOrRegisterHistogram(shadowMetric(shadow, "precision"), metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015)).Update(int64(comparison.Precision * 100))
+		metrics.GetOrRegisterHistogram(shadowMetric(shadow, "overlap"), metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015)).Update(int64(comparison.Overlap * 100))
+		logEntry.Infof("Shadow suggester %s suggested %d concepts, %d of the %d returned ones, precision %.2f, overlap %.2f",
+			shadow.GetName(), comparison.Shadow, comparison.Common, comparison.Primary, comparison.Precision, comparison.Overlap)
+	}
+}
+
+// WaitForShadows waits for the comparisons of the shadow suggestions in progress, e.g. before shutting down
+func (s *AggregateSuggester) WaitForShadows() {
+	s.shadows.Wait()
+}
+
+func compareSuggestions(shadow []Suggestion, primary []Suggestion) shadowComparison {
+	primaryIDs := make(map[string]bool, len(primary))
+	for _, suggestion := range primary {
+		primaryIDs[fp.Base(suggestion.ID)] = true
+	}
+	shadowIDs := make(map[string]bool, len(shadow))
+	for _, suggestion := range shadow {
+		shadowIDs[fp.Base(suggestion.ID)] = true
+	}
+
+	comparison := shadowComparison{Shadow: len(shadowIDs), Primary: len(primaryIDs)}
+	for id := range shadowIDs {
+		if primaryIDs[id] {
+			comparison.Common++
+		}
+	}
+	// empty sets agree with each other
+	comparison.Precision, comparison.Overlap = 1, 1
+	if comparison.Shadow > 0 {
+		comparison.Precision = float64(comparison.Common) / float64(comparison.Shadow)
+	}
+	if comparison.Primary > 0 {
+		comparison.Overlap = float64(comparison.Common) / float64(comparison.Primary)
+	}
+	return comparison
+}
+
+func shadowMetric(shadow Suggester, name string) string {
+	return "shadow." + strings.ReplaceAll(strings.ToLower(shadow.GetName()), " ", "-") + "." + name
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticSuggester struct {
+	name     string
+	response SuggestionsResponse
+	err      error
+}
+
+func (s *staticSuggester) GetSuggestions(payload []byte, tid string) (SuggestionsResponse, error) {
+	return s.response, s.err
+}
+
+func (s *staticSuggester) FilterSuggestions(suggestions []Suggestion) []Suggestion {
+	return suggestions
+}
+
+func (s *staticSuggester) GetName() string {
+	return s.name
+}
+
+func (s *staticSuggester) GetSystemID() string {
+	return strings.ReplaceAll(strings.ToLower(s.name), " ", "-")
+}
+
+func newTestAggregateSuggester(suggesters ...Suggester) (*AggregateSuggester, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/internalconcordances":
+			w.Write([]byte(`{"concepts": {
+				"a": {"id": "http://www.ft.com/thing/a", "prefLabel": "A", "type": "http://www.ft.com/ontology/Location"},
+				"b": {"id": "http://www.ft.com/thing/b", "prefLabel": "B", "type": "http://www.ft.com/ontology/Location"},
+				"c": {"id": "http://www.ft.com/thing/c", "prefLabel": "C", "type": "http://www.ft.com/ontology/Location"}
+			}}`))
+		case "/things":
+			w.Write([]byte(`{"things": {}}`))
+		case "/blacklist":
+			w.Write([]byte(`{"uuids": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	log := logger.NewUPPLogger("test-service", "panic")
+	suggester := NewAggregateSuggester(log, NewConcordance(server.URL, "/internalconcordances", http.DefaultClient),
+		NewBroaderConceptsProvider(server.URL, "/things", http.DefaultClient),
+		NewConceptBlacklister(server.URL, "/blacklist", http.DefaultClient), suggesters...)
+	return suggester, server.Close
+}
+
+func locations(ids ...string) SuggestionsResponse {
+	response := SuggestionsResponse{Suggestions: []Suggestion{}}
+	for _, id := range ids {
+		response.Suggestions = append(response.Suggestions, Suggestion{Concept: Concept{ID: "http://www.ft.com/thing/" + id, Type: ontologyLocationType}})
+	}
+	return response
+}
+
+func TestAggregateSuggester_ShadowSuggestionsAreOnlyCompared(t *testing.T) {
+	expect := assert.New(t)
+
+	primary := &staticSuggester{name: "Primary Suggestion API", response: locations("a", "b")}
+	shadow := &staticSuggester{name: "Shadow Comparison API", response: locations("b", "c")}
+	suggester, closeServer := newTestAggregateSuggester(primary)
+	defer closeServer()
+	suggester.Shadows = []Suggester{shadow}
+
+	calls := metrics.GetOrRegisterCounter("shadow.shadow-comparison-api.calls", metrics.DefaultRegistry).Count()
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	suggester.WaitForShadows()
+
+	var ids []string
+	for _, suggestion := range response.Suggestions {
+		ids = append(ids, suggestion.ID)
+	}
+	expect.Equal([]string{"http://www.ft.com/thing/a", "http://www.ft.com/thing/b"}, ids)
+
+	expect.Equal(calls+1, metrics.GetOrRegisterCounter("shadow.shadow-comparison-api.calls", metrics.DefaultRegistry).Count())
+	expect.Equal(int64(50), metrics.GetOrRegisterHistogram("shadow.shadow-comparison-api.precision", metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015)).Max())
+	expect.Equal(int64(50), metrics.GetOrRegisterHistogram("shadow.shadow-comparison-api.overlap", metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015)).Max())
+}
+
+func TestAggregateSuggester_ShadowSuggesterErrorDoesNotAffectResponse(t *testing.T) {
+	expect := assert.New(t)
+
+	primary := &staticSuggester{name: "Primary Suggestion API", response: locations("a")}
+	shadow := &staticSuggester{name: "Failing Shadow API", err: errors.New("shadow failure")}
+	suggester, closeServer := newTestAggregateSuggester(primary)
+	defer closeServer()
+	suggester.Shadows = []Suggester{shadow}
+
+	failures := metrics.GetOrRegisterCounter("shadow.failing-shadow-api.errors", metrics.DefaultRegistry).Count()
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	suggester.WaitForShadows()
+
+	expect.Len(response.Suggestions, 1)
+	expect.Equal(failures+1, metrics.GetOrRegisterCounter("shadow.failing-shadow-api.errors", metrics.DefaultRegistry).Count())
+}
+
+func TestAggregateSuggester_ShadowSuggestionsGoThroughProcessingStages(t *testing.T) {
+	expect := assert.New(t)
+
+	primary := &staticSuggester{name: "Primary Suggestion API", response: locations("a", "b")}
+	shadow := &staticSuggester{name: "Processed Shadow API", response: locations("a", "b")}
+	suggester, closeServer := newTestAggregateSuggester(primary)
+	defer closeServer()
+	suggester.Shadows = []Suggester{shadow}
+	suggester.Pipeline = append(DefaultPipeline(suggester.Concordance, suggester.BroaderProvider, suggester.Blacklister),
+		&dropProcessor{name: "drop", ids: map[string]bool{"http://www.ft.com/thing/b": true}})
+
+	response, err := suggester.GetSuggestions([]byte(`{"bodyXML":"Test body"}`), "tid_test")
+	expect.NoError(err)
+	suggester.WaitForShadows()
+
+	expect.Len(response.Suggestions, 1)
+	// the dropped suggestion is not held against the shadow suggester
+	expect.Equal(int64(100), metrics.GetOrRegisterHistogram("shadow.processed-shadow-api.precision", metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015)).Min())
+	expect.Equal(int64(100), metrics.GetOrRegisterHistogram("shadow.processed-shadow-api.overlap", metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015)).Min())
+}
+
+func TestCompareSuggestions(t *testing.T) {
+	expect := assert.New(t)
+
+	comparison := compareSuggestions(locations("a", "b", "c", "d").Suggestions, locations("a", "e").Suggestions)
+	expect.Equal(shadowComparison{Shadow: 4, Primary: 2, Common: 1, Precision: 0.25, Overlap: 0.5}, comparison)
+
+	comparison = compareSuggestions(nil, nil)
+	expect.Equal(shadowComparison{Precision: 1, Overlap: 1}, comparison)
+}
@@ -0,0 +1,84 @@
+package service
+
+// ConcordanceProcessor replaces the suggested concepts by their canonical concepts, dropping the concepts unknown to internal concordances
+type ConcordanceProcessor struct {
+	Concordance *ConcordanceService
+}
+
+func (p *ConcordanceProcessor) Name() string {
+	return ConcordanceStage
+}
+
+func (p *ConcordanceProcessor) Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	return concordSuggestions(p.Concordance, request.Log, suggestions, request.TID)
+}
+
+// ConceptTypesProcessor keeps the suggestions of the concept types targeted by the suggester which suggested them
+type ConceptTypesProcessor struct{}
+
+func (p *ConceptTypesProcessor) Name() string {
+	return ConceptTypesStage
+}
+
+func (p *ConceptTypesProcessor) Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	filtered := make(map[int][]Suggestion, len(suggestions))
+	for key, sourceSuggestions := range suggestions {
+		if len(sourceSuggestions) > 0 && key < len(request.Suggesters) {
+			sourceSuggestions = request.Suggesters[key].FilterSuggestions(sourceSuggestions)
+		}
+		filtered[key] = sourceSuggestions
+	}
+	return filtered, nil
+}
+
+// BroaderExclusionProcessor excludes the suggestions which are broader concepts of other suggestions.
+// Their broader concepts are looked up while the previous stages run, and the suggestions are left untouched when public things fails.
+type BroaderExclusionProcessor struct {
+	Provider *BroaderConceptsProvider
+}
+
+func (p *BroaderExclusionProcessor) Name() string {
+	return BroaderExclusionStage
+}
+
+func (p *BroaderExclusionProcessor) Prefetch(request *ProcessingRequest, suggestions map[int][]Suggestion) (interface{}, error) {
+	return p.Provider.lookupBroaderConcepts(suggestions, request.TID)
+}
+
+func (p *BroaderExclusionProcessor) Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	broader, err := request.Prefetched()
+	if err != nil {
+		request.Log.WithError(err).Warn("Couldn't exclude broader concepts. Response might contain broader concepts as well")
+		request.MarkIncomplete()
+		return suggestions, nil
+	}
+	return p.Provider.excludeBroaderConcepts(suggestions, broader.(*broaderResponse)), nil
+}
+
+// BlacklistProcessor drops the blacklisted concepts, using the blacklist retrieved for the request,
+// scoped entries applying to the predicate, type and suggester of each suggestion
+type BlacklistProcessor struct {
+	Blacklister ConceptBlacklister
+}
+
+func (p *BlacklistProcessor) Name() string {
+	return BlacklistStage
+}
+
+func (p *BlacklistProcessor) Process(request *ProcessingRequest, suggestions map[int][]Suggestion) (map[int][]Suggestion, error) {
+	filtered := make(map[int][]Suggestion, len(suggestions))
+	for key, sourceSuggestions := range suggestions {
+		var source string
+		if key < len(request.Suggesters) {
+			source = request.Suggesters[key].GetSystemID()
+		}
+		filtered[key] = []Suggestion{}
+		for _, suggestion := range sourceSuggestions {
+			scope := BlacklistScope{Predicate: suggestion.Predicate, Source: source, Type: suggestion.Type}
+			if !p.Blacklister.IsBlacklistedIn(suggestion.ID, scope, request.Blacklist) {
+				filtered[key] = append(filtered[key], suggestion)
+			}
+		}
+	}
+	return filtered, nil
+}
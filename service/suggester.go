@@ -2,11 +2,13 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	health "github.com/Financial-Times/go-fthealth/v1_1"
 )
@@ -66,6 +68,8 @@ type Suggester interface {
 	GetSuggestions(payload []byte, tid string) (SuggestionsResponse, error)
 	FilterSuggestions(suggestions []Suggestion) []Suggestion
 	GetName() string
+	// GetSystemID identifies the suggester in configurations, e.g. in the sources of the blacklist entries
+	GetSystemID() string
 }
 
 type SuggestionApi struct {
@@ -76,6 +80,8 @@ type SuggestionApi struct {
 	client               Client
 	systemId             string
 	failureImpact        string
+	traffic              *TrafficMonitor
+	hedging              *hedging
 }
 
 type AuthorsSuggester struct {
@@ -86,6 +92,11 @@ type OntotextSuggester struct {
 	SuggestionApi
 }
 
+// CandidateSuggester is a suggestion API under evaluation, with the same contract as the Ontotext one
+type CandidateSuggester struct {
+	SuggestionApi
+}
+
 type Suggestion struct {
 	Concept
 	Predicate string `json:"predicate,omitempty"`
@@ -101,6 +112,8 @@ type Concept struct {
 
 type SuggestionsResponse struct {
 	Suggestions []Suggestion `json:"suggestions"`
+	// Variant is the experiment variant which served the suggestions, if any
+	Variant string `json:"-"`
 }
 
 func NewAuthorsSuggester(authorsSuggestionApiBaseURL, authorsSuggestionEndpoint string, client Client) *AuthorsSuggester {
@@ -127,9 +140,38 @@ func NewOntotextSuggester(ontotextSuggestionApiBaseURL, ontotextSuggestionEndpoi
 	}}
 }
 
+func NewCandidateSuggester(systemID, candidateSuggestionApiBaseURL, candidateSuggestionEndpoint string, client Client) *CandidateSuggester {
+	return &CandidateSuggester{SuggestionApi{
+		apiBaseURL:           candidateSuggestionApiBaseURL,
+		suggestionEndpoint:   candidateSuggestionEndpoint,
+		client:               client,
+		name:                 systemID,
+		targetedConceptTypes: []string{LocationSourceParam, OrganisationSourceParam, PersonSourceParam, TopicSourceParam},
+		systemId:             systemID,
+		failureImpact:        "Evaluating the candidate suggestions won't work, suggestions are not affected",
+	}}
+}
+
+// MonitorTraffic makes the health check report the errors and latencies of the calls made for suggestions
+func (suggester *SuggestionApi) MonitorTraffic(monitor *TrafficMonitor) {
+	suggester.traffic = monitor
+}
+
 func (suggester *SuggestionApi) GetSuggestions(payload []byte, tid string) (SuggestionsResponse, error) {
+	start := time.Now()
+	var response SuggestionsResponse
+	var err error
+	if suggester.hedging != nil {
+		response, err = suggester.getHedgedSuggestions(payload, tid)
+	} else {
+		response, err = suggester.getSuggestions(context.Background(), suggester.apiBaseURL, payload, tid)
+	}
+	suggester.traffic.Record(time.Since(start), isDownstreamFailure(err))
+	return response, err
+}
 
-	req, err := http.NewRequest("POST", suggester.apiBaseURL+suggester.suggestionEndpoint, bytes.NewReader(payload))
+func (suggester *SuggestionApi) getSuggestions(ctx context.Context, baseURL string, payload []byte, tid string) (SuggestionsResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+suggester.suggestionEndpoint, bytes.NewReader(payload))
 	if err != nil {
 		return SuggestionsResponse{}, err
 	}
@@ -152,10 +194,10 @@ func (suggester *SuggestionApi) GetSuggestions(payload []byte, tid string) (Sugg
 
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusNoContent {
-			return SuggestionsResponse{make([]Suggestion, 0)}, NoContentError
+			return SuggestionsResponse{Suggestions: make([]Suggestion, 0)}, NoContentError
 		}
 		if resp.StatusCode == http.StatusBadRequest {
-			return SuggestionsResponse{make([]Suggestion, 0)}, BadRequestError
+			return SuggestionsResponse{Suggestions: make([]Suggestion, 0)}, BadRequestError
 		}
 		return SuggestionsResponse{}, fmt.Errorf("%v returned HTTP %v", suggester.name, resp.StatusCode)
 	}
@@ -169,10 +211,14 @@ func (suggester *SuggestionApi) GetSuggestions(payload []byte, tid string) (Sugg
 }
 
 func (suggester *SuggestionApi) FilterSuggestions(suggestions []Suggestion) []Suggestion {
+	return filterByConceptTypes(suggestions, suggester.targetedConceptTypes)
+}
+
+func filterByConceptTypes(suggestions []Suggestion, conceptTypes []string) []Suggestion {
 	var filtered []Suggestion
 
 	for _, suggestion := range suggestions {
-		for _, conceptType := range suggester.targetedConceptTypes {
+		for _, conceptType := range conceptTypes {
 			if typeValidators[conceptType](suggestion) {
 				filtered = append(filtered, suggestion)
 				break
@@ -187,6 +233,10 @@ func (suggester *SuggestionApi) GetName() string {
 	return suggester.name
 }
 
+func (suggester *SuggestionApi) GetSystemID() string {
+	return suggester.systemId
+}
+
 func (suggester *SuggestionApi) Check() health.Check {
 	return health.Check{
 		ID:               suggester.systemId,
@@ -200,22 +250,5 @@ func (suggester *SuggestionApi) Check() health.Check {
 }
 
 func (suggester *SuggestionApi) healthCheck() (string, error) {
-	req, err := http.NewRequest("GET", suggester.apiBaseURL+"/__gtg", nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Add("User-Agent", "UPP public-suggestions-api")
-
-	resp, err := suggester.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Health check returned a non-200 HTTP status: %v", resp.StatusCode)
-	}
-	return fmt.Sprintf("%v is healthy", suggester.name), nil
+	return checkGTG(suggester.name, suggester.client, suggester.apiBaseURL, suggester.traffic)
 }
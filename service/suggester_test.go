@@ -62,6 +62,10 @@ func (m *mockSuggestionApi) GetName() string {
 	return "Mock Suggestion API"
 }
 
+func (m *mockSuggestionApi) GetSystemID() string {
+	return "mock-suggestion-api"
+}
+
 type mockSuggestionApiServer struct {
 	mock.Mock
 }
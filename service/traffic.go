@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	trafficSlots           = 10
+	maxLatenciesPerSlot    = 1000
+	defaultTrafficWindow   = 5 * time.Minute
+	defaultMinTrafficCalls = 20
+)
+
+// TrafficMonitor keeps rolling statistics of the real calls made to a downstream service,
+// so that its health check fails when the service errors on real traffic while still answering to GTG checks.
+type TrafficMonitor struct {
+	errorThreshold float64
+	minCalls       int
+	slotDuration   time.Duration
+	mutex          sync.Mutex
+	slots          [trafficSlots]trafficSlot
+	now            func() time.Time
+}
+
+type trafficSlot struct {
+	start     time.Time
+	calls     int
+	errors    int
+	latencies []time.Duration
+}
+
+type TrafficStats struct {
+	Calls     int
+	Errors    int
+	ErrorRate float64
+	P50       time.Duration
+	P95       time.Duration
+	P99       time.Duration
+}
+
+// NewTrafficMonitor creates a monitor over the given rolling window, reporting the downstream as unhealthy
+// when the ratio of failed calls reaches errorThreshold, provided at least minCalls calls were made.
+// An errorThreshold of zero or less only collects statistics.
+func NewTrafficMonitor(window time.Duration, errorThreshold float64, minCalls int) *TrafficMonitor {
+	if window <= 0 {
+		window = defaultTrafficWindow
+	}
+	if minCalls <= 0 {
+		minCalls = defaultMinTrafficCalls
+	}
+	return &TrafficMonitor{
+		errorThreshold: errorThreshold,
+		minCalls:       minCalls,
+		slotDuration:   window / trafficSlots,
+		now:            time.Now,
+	}
+}
+
+// Record adds the outcome of a downstream call, doing nothing on a nil monitor
+func (m *TrafficMonitor) Record(latency time.Duration, failed bool) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	start := now.Truncate(m.slotDuration)
+	slot := &m.slots[(start.UnixNano()/int64(m.slotDuration))%trafficSlots]
+	if !slot.start.Equal(start) {
+		*slot = trafficSlot{start: start}
+	}
+
+	slot.calls++
+	if failed {
+		slot.errors++
+	}
+	if len(slot.latencies) < maxLatenciesPerSlot {
+		slot.latencies = append(slot.latencies, latency)
+	}
+}
+
+func (m *TrafficMonitor) Stats() TrafficStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var stats TrafficStats
+	var latencies []time.Duration
+	for _, slot := range m.recentSlots() {
+		stats.Calls += slot.calls
+		stats.Errors += slot.errors
+		latencies = append(latencies, slot.latencies...)
+	}
+
+	if stats.Calls > 0 {
+		stats.ErrorRate = float64(stats.Errors) / float64(stats.Calls)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.P50 = percentile(latencies, 0.50)
+	stats.P95 = percentile(latencies, 0.95)
+	stats.P99 = percentile(latencies, 0.99)
+	return stats
+}
+
+// LatencyPercentile returns the given percentile of the recent latencies,
+// or false when there were not enough recent calls for it to be meaningful.
+func (m *TrafficMonitor) LatencyPercentile(p float64) (time.Duration, bool) {
+	if m == nil {
+		return 0, false
+	}
+	m.mutex.Lock()
+	var latencies []time.Duration
+	for _, slot := range m.recentSlots() {
+		latencies = append(latencies, slot.latencies...)
+	}
+	m.mutex.Unlock()
+
+	if len(latencies) < m.minCalls {
+		return 0, false
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return percentile(latencies, p), true
+}
+
+// recentSlots returns the slots within the traffic window, the caller must hold the mutex
+func (m *TrafficMonitor) recentSlots() []trafficSlot {
+	var slots []trafficSlot
+	oldest := m.now().Truncate(m.slotDuration).Add(-m.slotDuration * (trafficSlots - 1))
+	for _, slot := range m.slots {
+		if !slot.start.Before(oldest) {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// Check returns a summary of the recent traffic, or an error when too many recent calls failed.
+// A nil monitor has nothing to report.
+func (m *TrafficMonitor) Check() (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	stats := m.Stats()
+	summary := fmt.Sprintf("recent traffic: %d calls, %.1f%% errors, p50 %v, p95 %v, p99 %v",
+		stats.Calls, stats.ErrorRate*100, stats.P50, stats.P95, stats.P99)
+
+	if m.errorThreshold > 0 && stats.Calls >= m.minCalls && stats.ErrorRate >= m.errorThreshold {
+		return "", errors.New("Too many failed calls, " + summary)
+	}
+	return summary, nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(p*float64(len(sorted))+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// healthyWithTraffic builds the output of a passed health check, failing it when the recent traffic has too many errors
+func healthyWithTraffic(name string, m *TrafficMonitor) (string, error) {
+	summary, err := m.Check()
+	if err != nil {
+		return "", err
+	}
+	if summary == "" {
+		return fmt.Sprintf("%v is healthy", name), nil
+	}
+	return fmt.Sprintf("%v is healthy, %s", name, summary), nil
+}
+
+// isDownstreamFailure tells whether a call error means the downstream service is failing,
+// as opposed to it having nothing to suggest or rejecting the content
+func isDownstreamFailure(err error) bool {
+	return err != nil && !errors.Is(err, NoContentError) && !errors.Is(err, BadRequestError)
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTrafficMonitor_Stats(t *testing.T) {
+	expect := assert.New(t)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	monitor := NewTrafficMonitor(time.Minute, 0.5, 10)
+	monitor.now = func() time.Time { return now }
+
+	for i := 1; i <= 100; i++ {
+		monitor.Record(time.Duration(i)*time.Millisecond, i%10 == 0)
+	}
+
+	stats := monitor.Stats()
+	expect.Equal(100, stats.Calls)
+	expect.Equal(10, stats.Errors)
+	expect.Equal(0.1, stats.ErrorRate)
+	expect.Equal(50*time.Millisecond, stats.P50)
+	expect.Equal(95*time.Millisecond, stats.P95)
+	expect.Equal(99*time.Millisecond, stats.P99)
+
+	output, err := monitor.Check()
+	expect.NoError(err)
+	expect.Equal("recent traffic: 100 calls, 10.0% errors, p50 50ms, p95 95ms, p99 99ms", output)
+}
+
+func TestTrafficMonitor_RollingWindow(t *testing.T) {
+	expect := assert.New(t)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	monitor := NewTrafficMonitor(time.Minute, 0.5, 1)
+	monitor.now = func() time.Time { return now }
+
+	monitor.Record(time.Millisecond, true)
+	now = now.Add(30 * time.Second)
+	monitor.Record(time.Millisecond, false)
+	expect.Equal(2, monitor.Stats().Calls)
+
+	now = now.Add(45 * time.Second)
+	stats := monitor.Stats()
+	expect.Equal(1, stats.Calls)
+	expect.Equal(0, stats.Errors)
+
+	now = now.Add(time.Minute)
+	expect.Equal(TrafficStats{}, monitor.Stats())
+}
+
+func TestTrafficMonitor_CheckFailsOverThreshold(t *testing.T) {
+	expect := assert.New(t)
+
+	monitor := NewTrafficMonitor(time.Minute, 0.5, 4)
+	monitor.Record(time.Millisecond, true)
+	monitor.Record(time.Millisecond, true)
+	monitor.Record(time.Millisecond, true)
+
+	// not enough calls to judge yet
+	_, err := monitor.Check()
+	expect.NoError(err)
+
+	monitor.Record(time.Millisecond, false)
+	_, err = monitor.Check()
+	expect.EqualError(err, "Too many failed calls, recent traffic: 4 calls, 75.0% errors, p50 1ms, p95 1ms, p99 1ms")
+}
+
+func TestTrafficMonitor_Nil(t *testing.T) {
+	expect := assert.New(t)
+
+	var monitor *TrafficMonitor
+	monitor.Record(time.Millisecond, true)
+	output, err := monitor.Check()
+
+	expect.NoError(err)
+	expect.Empty(output)
+}
+
+func TestOntotextSuggester_CheckHealthFailsOnRealTrafficErrors(t *testing.T) {
+	expect := assert.New(t)
+	mockServer := new(mockSuggestionApiServer)
+	mockServer.On("GTG").Return(200)
+	mockServer.On("UploadRequest", []byte("{}"), "tid_test", "application/json", "application/json").Return(http.StatusInternalServerError, []byte(`{"message":"error"}`))
+	server := mockServer.startMockServer(t)
+	defer server.Close()
+
+	suggester := NewOntotextSuggester(server.URL, "/content/suggest", http.DefaultClient)
+	suggester.MonitorTraffic(NewTrafficMonitor(time.Minute, 0.5, 2))
+
+	checkResult, err := suggester.Check().Checker()
+	expect.NoError(err)
+	expect.Contains(checkResult, "Ontotext Suggestion API is healthy, recent traffic: 0 calls")
+
+	for i := 0; i < 2; i++ {
+		_, err = suggester.GetSuggestions([]byte("{}"), "tid_test")
+		expect.Error(err)
+	}
+
+	checkResult, err = suggester.Check().Checker()
+	expect.Empty(checkResult)
+	expect.Error(err)
+	expect.Contains(err.Error(), "Too many failed calls, recent traffic: 2 calls, 100.0% errors")
+}
+
+func TestOntotextSuggester_NoContentIsNotAFailure(t *testing.T) {
+	expect := assert.New(t)
+	mockClient := new(mockHttpClient)
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{Body: ioutil.NopCloser(strings.NewReader("")), StatusCode: http.StatusNoContent}, nil)
+
+	suggester := NewOntotextSuggester("http://test-url", "/content/suggest", mockClient)
+	monitor := NewTrafficMonitor(time.Minute, 0.5, 1)
+	suggester.MonitorTraffic(monitor)
+
+	_, err := suggester.GetSuggestions([]byte("{}"), "tid_test")
+	expect.True(errors.Is(err, NoContentError))
+	expect.Equal(1, monitor.Stats().Calls)
+	expect.Equal(0, monitor.Stats().Errors)
+}
@@ -119,3 +119,30 @@ func getXmlSuggestionRequestFromJson(jsonData []byte) ([]byte, error) {
 
 	return data, nil
 }
+
+// ContentAttributes are the attributes of the content which the post-processing stages depend on
+type ContentAttributes struct {
+	Byline string
+	// Type is the type of the content, e.g. Article, it is not sent to the suggesters
+	Type string
+}
+
+func getContentAttributes(jsonData []byte) ContentAttributes {
+	var input struct {
+		Byline string `json:"byline"`
+		Type   string `json:"type"`
+	}
+	// payloads which are not JSON have no attributes
+	if err := json.Unmarshal(jsonData, &input); err != nil {
+		return ContentAttributes{}
+	}
+	return ContentAttributes{
+		Byline: TransformText(input.Byline,
+			HtmlEntityTransformer,
+			TagsRemover,
+			OuterSpaceTrimmer,
+			DuplicateWhiteSpaceRemover,
+		),
+		Type: input.Type,
+	}
+}
@@ -0,0 +1,117 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fixtures describes canned downstream responses by path and lower case HTTP method, in the format of the ersatz mock server
+type Fixtures struct {
+	Version  string                        `yaml:"version"`
+	Fixtures map[string]map[string]Fixture `yaml:"fixtures"`
+}
+
+type Fixture struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	Body    interface{}       `yaml:"body"`
+}
+
+func LoadFixtures(path string) (*Fixtures, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFixtures(data)
+}
+
+func ParseFixtures(data []byte) (*Fixtures, error) {
+	var fixtures Fixtures
+	if err := yaml.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("invalid fixtures: %w", err)
+	}
+	return &fixtures, nil
+}
+
+// Handler serves the fixture matching the path and method of each request, ignoring the query and the request body
+type Handler struct {
+	fixtures *Fixtures
+}
+
+func NewHandler(fixtures *Fixtures) *Handler {
+	return &Handler{fixtures: fixtures}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fixture, found := h.fixtures.Fixtures[r.URL.Path][strings.ToLower(r.Method)]
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(fmt.Sprintf(`{"message": "No fixture for %s %s"}`, r.Method, r.URL.Path)))
+		return
+	}
+
+	var body []byte
+	if fixture.Body != nil {
+		var err error
+		body, err = json.Marshal(jsonCompatible(fixture.Body))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(fmt.Sprintf(`{"message": "Fixture for %s %s cannot be encoded as JSON"}`, r.Method, r.URL.Path)))
+			return
+		}
+	}
+
+	for name, value := range fixture.Headers {
+		w.Header().Set(name, value)
+	}
+	status := fixture.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Client calls the handler in process, so that the downstream services can be stubbed without any network
+type Client struct {
+	handler http.Handler
+}
+
+func NewClient(handler http.Handler) *Client {
+	return &Client{handler: handler}
+}
+
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	c.handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// jsonCompatible converts the maps decoded from YAML, which have interface{} keys, to maps with string keys
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprintf("%v", key)] = jsonCompatible(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = jsonCompatible(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
@@ -0,0 +1,93 @@
+package stub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const fixturesPath = "../_ft/ersatz-fixtures.yml"
+
+func TestHandlerServesFixture(t *testing.T) {
+	expect := assert.New(t)
+
+	fixtures, err := LoadFixtures(fixturesPath)
+	expect.NoError(err)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://concept-suggestions-blacklister:8080/blacklist", nil)
+	resp, err := NewClient(NewHandler(fixtures)).Do(req)
+	expect.NoError(err)
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	expect.Equal(http.StatusOK, resp.StatusCode)
+	expect.JSONEq(`{"uuids": ["f758ef56-c40a-3162-91aa-3e8a3aabc495"]}`, string(body))
+}
+
+func TestHandlerFixtureHeadersAndDefaultStatus(t *testing.T) {
+	expect := assert.New(t)
+
+	fixtures, err := ParseFixtures([]byte(`
+fixtures:
+  /things:
+    get:
+      headers:
+        content-type: application/json
+      body:
+        things:
+          6f14ea94-690f-3ed4-98c7-b926683c735a:
+            id: http://www.ft.com/thing/6f14ea94-690f-3ed4-98c7-b926683c735a
+`))
+	expect.NoError(err)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://public-things-api:8080/things?uuid=6f14ea94-690f-3ed4-98c7-b926683c735a", nil)
+	resp, err := NewClient(NewHandler(fixtures)).Do(req)
+	expect.NoError(err)
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	expect.Equal(http.StatusOK, resp.StatusCode)
+	expect.Equal("application/json", resp.Header.Get("Content-Type"))
+	expect.JSONEq(`{"things": {"6f14ea94-690f-3ed4-98c7-b926683c735a": {"id": "http://www.ft.com/thing/6f14ea94-690f-3ed4-98c7-b926683c735a"}}}`, string(body))
+}
+
+func TestHandlerNoFixture(t *testing.T) {
+	expect := assert.New(t)
+
+	fixtures, err := ParseFixtures([]byte(`fixtures: {}`))
+	expect.NoError(err)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://ontotext-suggestion-api:8080/content/suggest/ontotext", nil)
+	resp, err := NewClient(NewHandler(fixtures)).Do(req)
+	expect.NoError(err)
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	expect.Equal(http.StatusNotFound, resp.StatusCode)
+	expect.JSONEq(`{"message": "No fixture for POST /content/suggest/ontotext"}`, string(body))
+}
+
+func TestParseFixturesInvalid(t *testing.T) {
+	_, err := ParseFixtures([]byte(`fixtures: [`))
+	assert.Error(t, err)
+}
+
+func TestStubbedSuggestions(t *testing.T) {
+	expect := assert.New(t)
+
+	fixtures, err := LoadFixtures(fixturesPath)
+	expect.NoError(err)
+	client := NewClient(NewHandler(fixtures))
+
+	response, err := newTestSuggester(client).GetSuggestions([]byte(`{"byline": "By Adam Samson", "bodyXML": "Apple in London"}`), "tid_test")
+	expect.NoError(err)
+
+	var labels []string
+	for _, suggestion := range response.Suggestions {
+		labels = append(labels, suggestion.PrefLabel)
+	}
+	// London is blacklisted
+	expect.Equal([]string{"Adam Samson", "Michael Hunter", "Eric Platt", "Apple"}, labels)
+}
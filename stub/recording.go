@@ -0,0 +1,251 @@
+package stub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Financial-Times/public-suggestions-api/service"
+)
+
+const recordingExtension = ".jsonl"
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// recordingMutex serialises the writes of all the recording clients, since the calls to several downstream services are recorded in the same file
+var recordingMutex sync.Mutex
+
+// Exchange is a downstream request with the response it got
+type Exchange struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// RecordingClient saves the downstream requests made for a transaction, with their responses, in a file named after the transaction ID,
+// so that the transaction can be replayed later with a ReplayClient. Requests without a transaction ID are not recorded.
+// Requests shared between concurrent transactions are only recorded for the transaction which made them,
+// so request collapsing should be disabled on the services while recording.
+type RecordingClient struct {
+	client         service.Client
+	dir            string
+	transactionIDs map[string]bool
+}
+
+// NewRecordingClient records the transactions with the given IDs in dir, or all of them when no ID is given
+func NewRecordingClient(client service.Client, dir string, transactionIDs ...string) *RecordingClient {
+	ids := make(map[string]bool, len(transactionIDs))
+	for _, id := range transactionIDs {
+		ids[id] = true
+	}
+	return &RecordingClient{client: client, dir: dir, transactionIDs: ids}
+}
+
+func (c *RecordingClient) Do(req *http.Request) (*http.Response, error) {
+	tid := req.Header.Get("X-Request-Id")
+	if tid == "" || (len(c.transactionIDs) > 0 && !c.transactionIDs[tid]) {
+		return c.client.Do(req)
+	}
+
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	exchange := Exchange{
+		Request:  RecordedRequest{Method: req.Method, URL: req.URL.String(), Body: string(reqBody)},
+		Response: RecordedResponse{Status: resp.StatusCode, Headers: resp.Header, Body: string(respBody)},
+	}
+	if err := c.record(tid, exchange); err != nil {
+		return nil, fmt.Errorf("recording the downstream request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func (c *RecordingClient) record(tid string, exchange Exchange) error {
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+
+	recordingMutex.Lock()
+	defer recordingMutex.Unlock()
+	f, err := os.OpenFile(RecordingPath(c.dir, tid), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RecordingPath is the file in which the transaction with the given ID is recorded
+func RecordingPath(dir string, tid string) string {
+	return filepath.Join(dir, unsafeFileNameChars.ReplaceAllString(tid, "_")+recordingExtension)
+}
+
+// LoadRecording reads the exchanges recorded for a transaction by a RecordingClient
+func LoadRecording(dir string, tid string) ([]Exchange, error) {
+	f, err := os.Open(RecordingPath(dir, tid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var exchange Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("invalid recording for transaction %s: %w", tid, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, scanner.Err()
+}
+
+// ErrNotRecorded is returned by a ReplayClient for the requests missing from the recording
+var ErrNotRecorded = errors.New("not recorded")
+
+// ReplayClient answers downstream requests with recorded responses.
+// Requests match on their method, URL and body, regardless of the order of the query parameters,
+// and identical requests get the recorded responses in order, the last one being repeated.
+// The services tolerate some downstream failures, e.g. of the blacklist, so the requests missing from the recording are also reported by Err.
+type ReplayClient struct {
+	mutex     sync.Mutex
+	responses map[string][]RecordedResponse
+	missing   []string
+}
+
+func NewReplayClient(exchanges []Exchange) (*ReplayClient, error) {
+	c := &ReplayClient{responses: map[string][]RecordedResponse{}}
+	for _, exchange := range exchanges {
+		key, err := exchangeKey(exchange.Request.Method, exchange.Request.URL, exchange.Request.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.responses[key] = append(c.responses[key], exchange.Response)
+	}
+	return c, nil
+}
+
+func (c *ReplayClient) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	key, err := exchangeKey(req.Method, req.URL.String(), string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	responses := c.responses[key]
+	if len(responses) == 0 {
+		c.missing = append(c.missing, req.Method+" "+req.URL.String())
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("no recorded response for %s %s: %w", req.Method, req.URL.String(), ErrNotRecorded)
+	}
+	recorded := responses[0]
+	if len(responses) > 1 {
+		c.responses[key] = responses[1:]
+	}
+	c.mutex.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Headers,
+		Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Err reports the requests which were missing from the recording, if any
+func (c *ReplayClient) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("no recorded response for %s: %w", strings.Join(c.missing, ", "), ErrNotRecorded)
+}
+
+// ReplaySuggestions gets the suggestions of a recorded transaction from the suggester built with a ReplayClient,
+// failing when the suggester made a request missing from the recording, even if it could answer without it
+func ReplaySuggestions(exchanges []Exchange, newSuggester func(client service.Client) *service.AggregateSuggester, payload []byte, tid string) (service.SuggestionsResponse, error) {
+	client, err := NewReplayClient(exchanges)
+	if err != nil {
+		return service.SuggestionsResponse{}, err
+	}
+	response, err := newSuggester(client).GetSuggestions(payload, tid)
+	if err != nil {
+		return response, err
+	}
+	return response, client.Err()
+}
+
+// exchangeKey identifies a request, sorting its query parameters since they are built from unordered sets of concept IDs
+func exchangeKey(method string, rawURL string, body string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	u.RawQuery = query.Encode()
+	return method + " " + u.String() + "\n" + body, nil
+}
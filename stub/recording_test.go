@@ -0,0 +1,173 @@
+package stub
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/public-suggestions-api/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSuggester(client service.Client) *service.AggregateSuggester {
+	return service.NewAggregateSuggester(logger.NewUPPLogger("test", "PANIC"),
+		service.NewConcordance("http://internal-concordances:8080", "/internalconcordances", client),
+		service.NewBroaderConceptsProvider("http://public-things-api:8080", "/things", client),
+		service.NewConceptBlacklister("http://concept-suggestions-blacklister:8080", "/blacklist", client),
+		service.NewAuthorsSuggester("http://authors-suggestion-api:8080", "/content/suggest/authors", client),
+		service.NewOntotextSuggester("http://ontotext-suggestion-api:8080", "/content/suggest/ontotext", client))
+}
+
+func newRecordingSuggester(client service.Client) *service.AggregateSuggester {
+	concordance := service.NewConcordance("http://internal-concordances:8080", "/internalconcordances", client)
+	concordance.DisableRequestCollapsing()
+	blacklister := service.NewConceptBlacklister("http://concept-suggestions-blacklister:8080", "/blacklist", client)
+	blacklister.DisableRequestCollapsing()
+	suggester := service.NewAggregateSuggester(logger.NewUPPLogger("test", "PANIC"),
+		concordance,
+		service.NewBroaderConceptsProvider("http://public-things-api:8080", "/things", client),
+		blacklister,
+		service.NewAuthorsSuggester("http://authors-suggestion-api:8080", "/content/suggest/authors", client),
+		service.NewOntotextSuggester("http://ontotext-suggestion-api:8080", "/content/suggest/ontotext", client))
+	suggester.DisableRequestCollapsing()
+	return suggester
+}
+
+func TestRecordAndReplaySuggestions(t *testing.T) {
+	expect := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "recordings")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fixtures, err := LoadFixtures(fixturesPath)
+	expect.NoError(err)
+	payload := []byte(`{"byline": "By Adam Samson", "bodyXML": "Apple in London"}`)
+
+	recorder := NewRecordingClient(NewClient(NewHandler(fixtures)), dir, "tid_recorded")
+	recorded, err := newTestSuggester(recorder).GetSuggestions(payload, "tid_recorded")
+	expect.NoError(err)
+	_, err = newTestSuggester(recorder).GetSuggestions(payload, "tid_ignored")
+	expect.NoError(err)
+
+	_, err = os.Stat(RecordingPath(dir, "tid_ignored"))
+	expect.True(os.IsNotExist(err))
+
+	exchanges, err := LoadRecording(dir, "tid_recorded")
+	expect.NoError(err)
+	// suggesters, blacklist, concordances and broader concepts
+	expect.Len(exchanges, 5)
+
+	replayed, err := ReplaySuggestions(exchanges, newTestSuggester, payload, "tid_replayed")
+	expect.NoError(err)
+	expect.Equal(recorded, replayed)
+}
+
+func TestRecordConcurrentIdenticalTransactions(t *testing.T) {
+	expect := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "recordings")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fixtures, err := LoadFixtures(fixturesPath)
+	expect.NoError(err)
+	payload := []byte(`{"byline": "By Adam Samson", "bodyXML": "Apple in London"}`)
+
+	suggester := newRecordingSuggester(NewRecordingClient(NewClient(NewHandler(fixtures)), dir))
+	var wg sync.WaitGroup
+	for _, tid := range []string{"tid_first", "tid_second"} {
+		wg.Add(1)
+		go func(tid string) {
+			defer wg.Done()
+			_, err := suggester.GetSuggestions(payload, tid)
+			expect.NoError(err)
+		}(tid)
+	}
+	wg.Wait()
+
+	for _, tid := range []string{"tid_first", "tid_second"} {
+		exchanges, err := LoadRecording(dir, tid)
+		expect.NoError(err)
+		expect.Len(exchanges, 5, tid)
+	}
+}
+
+func TestReplaySuggestionsWithMissingExchange(t *testing.T) {
+	expect := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "recordings")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fixtures, err := LoadFixtures(fixturesPath)
+	expect.NoError(err)
+	payload := []byte(`{"byline": "By Adam Samson", "bodyXML": "Apple in London"}`)
+
+	_, err = newTestSuggester(NewRecordingClient(NewClient(NewHandler(fixtures)), dir)).GetSuggestions(payload, "tid_recorded")
+	expect.NoError(err)
+	exchanges, err := LoadRecording(dir, "tid_recorded")
+	expect.NoError(err)
+
+	var withoutBlacklist []Exchange
+	for _, exchange := range exchanges {
+		if !strings.Contains(exchange.Request.URL, "/blacklist") {
+			withoutBlacklist = append(withoutBlacklist, exchange)
+		}
+	}
+	expect.Len(withoutBlacklist, len(exchanges)-1)
+
+	// the suggestions are still served without the blacklist, but the replay must not pass for the recorded transaction
+	_, err = ReplaySuggestions(withoutBlacklist, newTestSuggester, payload, "tid_replayed")
+	expect.EqualError(err, "no recorded response for GET http://concept-suggestions-blacklister:8080/blacklist: not recorded")
+	expect.True(errors.Is(err, ErrNotRecorded))
+}
+
+func TestReplayClientMatchesUnorderedQuery(t *testing.T) {
+	expect := assert.New(t)
+
+	client, err := NewReplayClient([]Exchange{{
+		Request:  RecordedRequest{Method: http.MethodGet, URL: "http://public-things-api:8080/things?uuid=b&uuid=a&showRelationship=broader"},
+		Response: RecordedResponse{Status: http.StatusOK, Body: `{"things": {}}`},
+	}})
+	expect.NoError(err)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://public-things-api:8080/things?showRelationship=broader&uuid=a&uuid=b", nil)
+	resp, err := client.Do(req)
+	expect.NoError(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	expect.Equal(http.StatusOK, resp.StatusCode)
+	expect.Equal(`{"things": {}}`, string(body))
+}
+
+func TestReplayClientRepliesInOrder(t *testing.T) {
+	expect := assert.New(t)
+
+	client, err := NewReplayClient([]Exchange{
+		{Request: RecordedRequest{Method: http.MethodPost, URL: "http://ontotext-suggestion-api:8080/content/suggest/ontotext", Body: "content"}, Response: RecordedResponse{Status: http.StatusServiceUnavailable}},
+		{Request: RecordedRequest{Method: http.MethodPost, URL: "http://ontotext-suggestion-api:8080/content/suggest/ontotext", Body: "content"}, Response: RecordedResponse{Status: http.StatusOK}},
+	})
+	expect.NoError(err)
+
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusOK} {
+		req, _ := http.NewRequest(http.MethodPost, "http://ontotext-suggestion-api:8080/content/suggest/ontotext", strings.NewReader("content"))
+		resp, err := client.Do(req)
+		expect.NoError(err)
+		expect.Equal(status, resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://ontotext-suggestion-api:8080/content/suggest/ontotext", strings.NewReader("other content"))
+	_, err = client.Do(req)
+	expect.EqualError(err, "no recorded response for POST http://ontotext-suggestion-api:8080/content/suggest/ontotext: not recorded")
+	expect.True(errors.Is(err, ErrNotRecorded))
+	expect.EqualError(client.Err(), "no recorded response for POST http://ontotext-suggestion-api:8080/content/suggest/ontotext: not recorded")
+}
+
+func TestRecordingPathSanitizesTransactionID(t *testing.T) {
+	assert.Equal(t, "recordings/tid_.._secret.jsonl", RecordingPath("recordings", "tid_../secret"))
+}
@@ -0,0 +1,155 @@
+package web
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	LaneInteractive = "interactive"
+	LaneBulk        = "bulk"
+)
+
+// lanes in order of priority
+var lanes = []string{LaneInteractive, LaneBulk}
+
+// AdmissionController limits the number of requests processed concurrently.
+// Requests over the limit wait in a queue of their priority lane, interactive requests being admitted before bulk ones,
+// and are rejected with HTTP 429 when the queue is full or they waited longer than the queue timeout.
+// Requests cancelled by their client while waiting leave the queue without any response.
+type AdmissionController struct {
+	maxInFlight    int
+	maxQueued      int
+	queueTimeout   time.Duration
+	priorityHeader string
+	mutex          sync.Mutex
+	inFlight       int
+	queues         map[string]*list.List
+	rejected       map[string]metrics.Counter
+}
+
+// NewAdmissionController creates an admission controller, requests having the bulk value in priorityHeader use the bulk lane.
+// A maxInFlight of zero or less disables admission control.
+func NewAdmissionController(maxInFlight int, maxQueued int, queueTimeout time.Duration, priorityHeader string) *AdmissionController {
+	a := &AdmissionController{
+		maxInFlight:    maxInFlight,
+		maxQueued:      maxQueued,
+		queueTimeout:   queueTimeout,
+		priorityHeader: priorityHeader,
+		queues:         map[string]*list.List{},
+		rejected:       map[string]metrics.Counter{},
+	}
+	for _, lane := range lanes {
+		a.queues[lane] = list.New()
+		a.rejected[lane] = metrics.GetOrRegisterCounter(fmt.Sprintf("suggest.requests.rejected.%s", lane), metrics.DefaultRegistry)
+	}
+	return a
+}
+
+func (a *AdmissionController) Handler(next http.Handler) http.Handler {
+	if a.maxInFlight <= 0 {
+		return next
+	}
+	retryAfter := fmt.Sprintf("%d", int(math.Max(1, math.Ceil(a.queueTimeout.Seconds()))))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lane := a.lane(r)
+		if !a.acquire(r.Context(), lane) {
+			if r.Context().Err() != nil {
+				// the client is gone, nobody is waiting for a response
+				return
+			}
+			a.rejected[lane].Inc(1)
+			w.Header().Set("Retry-After", retryAfter)
+			writeResponse(w, http.StatusTooManyRequests, []byte(`{"message": "Too many suggestion requests, please retry later"}`))
+			return
+		}
+		defer a.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *AdmissionController) lane(r *http.Request) string {
+	if strings.EqualFold(r.Header.Get(a.priorityHeader), LaneBulk) {
+		return LaneBulk
+	}
+	return LaneInteractive
+}
+
+func (a *AdmissionController) acquire(ctx context.Context, lane string) bool {
+	a.mutex.Lock()
+	if a.inFlight < a.maxInFlight && a.queued() == 0 {
+		a.inFlight++
+		a.mutex.Unlock()
+		return true
+	}
+
+	queue := a.queues[lane]
+	if queue.Len() >= a.maxQueued {
+		a.mutex.Unlock()
+		return false
+	}
+	admitted := make(chan struct{})
+	element := queue.PushBack(admitted)
+	a.mutex.Unlock()
+
+	timer := time.NewTimer(a.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-admitted:
+		return true
+	case <-timer.C:
+		return a.leave(queue, element, admitted)
+	case <-ctx.Done():
+		if a.leave(queue, element, admitted) {
+			// admitted while being cancelled, the slot goes to the next request
+			a.release()
+		}
+		return false
+	}
+}
+
+// leave removes a request from its queue, unless it was admitted meanwhile, in which case the slot is already its own
+func (a *AdmissionController) leave(queue *list.List, element *list.Element, admitted chan struct{}) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	select {
+	case <-admitted:
+		return true
+	default:
+		queue.Remove(element)
+		return false
+	}
+}
+
+// release hands the slot over to the first queued request by priority, or frees it when none is waiting
+func (a *AdmissionController) release() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, lane := range lanes {
+		queue := a.queues[lane]
+		if queue.Len() > 0 {
+			close(queue.Remove(queue.Front()).(chan struct{}))
+			return
+		}
+	}
+	a.inFlight--
+}
+
+func (a *AdmissionController) queued() int {
+	total := 0
+	for _, queue := range a.queues {
+		total += queue.Len()
+	}
+	return total
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type blockingHandler struct {
+	started chan string
+	release chan struct{}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.started <- r.Header.Get("X-Request-Id")
+	<-h.release
+	w.WriteHeader(http.StatusOK)
+}
+
+func serveAsync(handler http.Handler, tid string, priority string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	req := httptest.NewRequest("POST", "/content/suggest", nil)
+	req.Header.Set("X-Request-Id", tid)
+	req.Header.Set("X-Request-Priority", priority)
+	go func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		done <- w
+	}()
+	return done
+}
+
+func TestAdmissionController_Disabled(t *testing.T) {
+	expect := assert.New(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := NewAdmissionController(0, 0, time.Second, "X-Request-Priority").Handler(next)
+
+	expect.NotNil(handler)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/content/suggest", nil))
+	expect.Equal(http.StatusOK, w.Code)
+}
+
+func TestAdmissionController_RejectsWhenQueueIsFull(t *testing.T) {
+	expect := assert.New(t)
+
+	next := &blockingHandler{started: make(chan string, 10), release: make(chan struct{})}
+	admission := NewAdmissionController(1, 1, time.Second, "X-Request-Priority")
+	handler := admission.Handler(next)
+	rejectedBefore := admission.rejected[LaneInteractive].Count()
+
+	first := serveAsync(handler, "tid_first", "")
+	expect.Equal("tid_first", <-next.started)
+	second := serveAsync(handler, "tid_second", "")
+	waitForQueued(admission, 1)
+
+	w := <-serveAsync(handler, "tid_third", "")
+	expect.Equal(http.StatusTooManyRequests, w.Code)
+	expect.Equal("1", w.Header().Get("Retry-After"))
+	expect.Equal(`{"message": "Too many suggestion requests, please retry later"}`, w.Body.String())
+	expect.Equal(rejectedBefore+1, admission.rejected[LaneInteractive].Count())
+
+	close(next.release)
+	expect.Equal(http.StatusOK, (<-first).Code)
+	expect.Equal(http.StatusOK, (<-second).Code)
+}
+
+func TestAdmissionController_RejectsAfterQueueTimeout(t *testing.T) {
+	expect := assert.New(t)
+
+	next := &blockingHandler{started: make(chan string, 10), release: make(chan struct{})}
+	admission := NewAdmissionController(1, 10, 50*time.Millisecond, "X-Request-Priority")
+	handler := admission.Handler(next)
+
+	first := serveAsync(handler, "tid_first", "")
+	<-next.started
+
+	w := <-serveAsync(handler, "tid_second", "")
+	expect.Equal(http.StatusTooManyRequests, w.Code)
+	expect.Equal(0, admission.queued())
+
+	close(next.release)
+	expect.Equal(http.StatusOK, (<-first).Code)
+}
+
+func TestAdmissionController_InteractiveBeforeBulk(t *testing.T) {
+	expect := assert.New(t)
+
+	next := &blockingHandler{started: make(chan string, 10), release: make(chan struct{})}
+	admission := NewAdmissionController(1, 10, time.Second, "X-Request-Priority")
+	handler := admission.Handler(next)
+
+	first := serveAsync(handler, "tid_first", "")
+	<-next.started
+
+	bulk := serveAsync(handler, "tid_bulk", "bulk")
+	waitForQueued(admission, 1)
+	interactive := serveAsync(handler, "tid_interactive", "")
+	waitForQueued(admission, 2)
+
+	next.release <- struct{}{}
+	expect.Equal(http.StatusOK, (<-first).Code)
+	expect.Equal("tid_interactive", <-next.started)
+
+	next.release <- struct{}{}
+	expect.Equal(http.StatusOK, (<-interactive).Code)
+	expect.Equal("tid_bulk", <-next.started)
+
+	next.release <- struct{}{}
+	expect.Equal(http.StatusOK, (<-bulk).Code)
+	expect.Equal(0, admission.inFlight)
+}
+
+func TestAdmissionController_CancelledRequestLeavesQueue(t *testing.T) {
+	expect := assert.New(t)
+
+	next := &blockingHandler{started: make(chan string, 10), release: make(chan struct{})}
+	admission := NewAdmissionController(1, 10, time.Minute, "X-Request-Priority")
+	handler := admission.Handler(next)
+	rejectedBefore := admission.rejected[LaneInteractive].Count()
+
+	first := serveAsync(handler, "tid_first", "")
+	<-next.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/content/suggest", nil).WithContext(ctx))
+		cancelled <- w
+	}()
+	waitForQueued(admission, 1)
+	cancel()
+
+	w := <-cancelled
+	expect.Empty(w.Body.String())
+	expect.Equal(0, admission.queued())
+	expect.Equal(rejectedBefore, admission.rejected[LaneInteractive].Count())
+
+	next.release <- struct{}{}
+	expect.Equal(http.StatusOK, (<-first).Code)
+	expect.Equal(0, admission.inFlight)
+}
+
+func waitForQueued(admission *AdmissionController, expected int) {
+	for i := 0; i < 100; i++ {
+		admission.mutex.Lock()
+		queued := admission.queued()
+		admission.mutex.Unlock()
+		if queued == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
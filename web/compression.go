@@ -0,0 +1,121 @@
+package web
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// supportedEncodings lists the response encodings in order of preference
+var supportedEncodings = []string{encodingBrotli, encodingGzip}
+
+// CompressionHandler compresses responses with brotli or gzip, as negotiated with the client through the Accept-Encoding header.
+func CompressionHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		accepted[coding] = true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil && q == 0 {
+				accepted[coding] = false
+			}
+		}
+	}
+
+	for _, encoding := range supportedEncodings {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressResponseWriter holds the status back until the first bytes of the body,
+// so that responses without a body are sent without Content-Encoding
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	writer      io.WriteCloser
+	wroteHeader bool
+	status      int
+	skip        bool
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	// responses without a body or already encoded are sent as they are
+	if status == http.StatusNotModified || status == http.StatusNoContent || cw.Header().Get("Content-Encoding") != "" {
+		cw.skip = true
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.skip {
+		return cw.ResponseWriter.Write(b)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if cw.writer == nil {
+		cw.Header().Set("Content-Encoding", cw.encoding)
+		cw.Header().Del("Content-Length")
+		cw.ResponseWriter.WriteHeader(cw.status)
+		switch cw.encoding {
+		case encodingBrotli:
+			cw.writer = brotli.NewWriter(cw.ResponseWriter)
+		default:
+			cw.writer = gzip.NewWriter(cw.ResponseWriter)
+		}
+	}
+	return cw.writer.Write(b)
+}
+
+func (cw *compressResponseWriter) Close() error {
+	if cw.writer == nil {
+		// no body was written, the status held back is sent without encoding
+		if cw.wroteHeader && !cw.skip {
+			cw.ResponseWriter.WriteHeader(cw.status)
+		}
+		return nil
+	}
+	return cw.writer.Close()
+}
@@ -0,0 +1,110 @@
+package web
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+const compressionTestBody = `{"suggestions":[{"id":"http://www.ft.com/thing/f758ef56-c40a-3162-91aa-3e8a3aabc495","prefLabel":"London"}]}`
+
+func compressionTestHandler() http.Handler {
+	return CompressionHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, http.StatusOK, []byte(compressionTestBody))
+	}))
+}
+
+func TestCompressionHandler_Gzip(t *testing.T) {
+	expect := assert.New(t)
+
+	req := httptest.NewRequest("POST", "/content/suggest", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	compressionTestHandler().ServeHTTP(w, req)
+
+	expect.Equal(http.StatusOK, w.Code)
+	expect.Equal("gzip", w.Header().Get("Content-Encoding"))
+	expect.Equal("Accept-Encoding", w.Header().Get("Vary"))
+
+	reader, err := gzip.NewReader(w.Body)
+	expect.NoError(err)
+	body, err := ioutil.ReadAll(reader)
+	expect.NoError(err)
+	expect.Equal(compressionTestBody, string(body))
+}
+
+func TestCompressionHandler_BrotliPreferred(t *testing.T) {
+	expect := assert.New(t)
+
+	req := httptest.NewRequest("POST", "/content/suggest", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	w := httptest.NewRecorder()
+	compressionTestHandler().ServeHTTP(w, req)
+
+	expect.Equal("br", w.Header().Get("Content-Encoding"))
+	body, err := ioutil.ReadAll(brotli.NewReader(w.Body))
+	expect.NoError(err)
+	expect.Equal(compressionTestBody, string(body))
+}
+
+func TestCompressionHandler_Identity(t *testing.T) {
+	expect := assert.New(t)
+
+	testCases := []struct {
+		testName       string
+		acceptEncoding string
+	}{
+		{testName: "noAcceptEncoding", acceptEncoding: ""},
+		{testName: "unsupportedEncoding", acceptEncoding: "deflate"},
+		{testName: "refusedEncodings", acceptEncoding: "gzip;q=0, br;q=0.0, identity"},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest("POST", "/content/suggest", nil)
+		req.Header.Set("Accept-Encoding", testCase.acceptEncoding)
+		w := httptest.NewRecorder()
+		compressionTestHandler().ServeHTTP(w, req)
+
+		expect.Empty(w.Header().Get("Content-Encoding"), testCase.testName)
+		expect.Equal(compressionTestBody, w.Body.String(), testCase.testName)
+	}
+}
+
+func TestCompressionHandler_NotModified(t *testing.T) {
+	expect := assert.New(t)
+
+	handler := CompressionHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	req := httptest.NewRequest("POST", "/content/suggest", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	expect.Equal(http.StatusNotModified, w.Code)
+	expect.Empty(w.Header().Get("Content-Encoding"))
+	expect.Empty(w.Body.Bytes())
+}
+
+func TestCompressionHandler_EmptyBody(t *testing.T) {
+	expect := assert.New(t)
+
+	handler := CompressionHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest("POST", "/content/suggest", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	expect.Equal(http.StatusOK, w.Code)
+	expect.Empty(w.Header().Get("Content-Encoding"))
+	expect.Equal("0", w.Header().Get("Content-Length"))
+	expect.Empty(w.Body.Bytes())
+}
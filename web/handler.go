@@ -1,26 +1,48 @@
 package web
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/public-suggestions-api/service"
 	tidutils "github.com/Financial-Times/transactionid-utils-go"
+	"github.com/rcrowley/go-metrics"
 )
 
+const (
+	diffParam     = "diff"
+	impliedParam  = "implied"
+	variantHeader = "X-Suggestions-Variant"
+)
+
+type diffRequest struct {
+	ExistingAnnotations []service.Annotation `json:"existingAnnotations"`
+}
+
+var RequestTooLargeError = errors.New("request body exceeded the maximum allowed size")
+
 type RequestHandler struct {
-	suggester *service.AggregateSuggester
-	log       *logger.UPPLogger
+	suggester        *service.AggregateSuggester
+	log              *logger.UPPLogger
+	maxBodySize      int64
+	oversizeRequests metrics.Counter
 }
 
-func NewRequestHandler(s *service.AggregateSuggester, log *logger.UPPLogger) *RequestHandler {
+// NewRequestHandler creates the handler for suggestion requests, rejecting request bodies bigger than maxBodySize bytes.
+// A maxBodySize of zero or less disables the limit.
+func NewRequestHandler(s *service.AggregateSuggester, log *logger.UPPLogger, maxBodySize int64) *RequestHandler {
 	return &RequestHandler{
-		suggester: s,
-		log:       log,
+		suggester:        s,
+		log:              log,
+		maxBodySize:      maxBodySize,
+		oversizeRequests: metrics.GetOrRegisterCounter("suggest.requests.oversize", metrics.DefaultRegistry),
 	}
 }
 
@@ -29,7 +51,25 @@ func (h *RequestHandler) HandleSuggestion(resp http.ResponseWriter, req *http.Re
 	tid := tidutils.GetTransactionIDFromRequest(req)
 	logEntry := h.log.WithTransactionID(tid)
 
+	if h.maxBodySize > 0 {
+		if req.ContentLength > h.maxBodySize {
+			h.oversizeRequests.Inc(1)
+			h.writeRequestTooLarge(resp, logEntry)
+			return
+		}
+		req.Body = &service.LimitedReadCloser{
+			ReadCloser: req.Body,
+			N:          h.maxBodySize,
+			Err:        RequestTooLargeError,
+			OnExceeded: func() { h.oversizeRequests.Inc(1) },
+		}
+	}
+
 	body, err := ioutil.ReadAll(req.Body)
+	if errors.Is(err, RequestTooLargeError) {
+		h.writeRequestTooLarge(resp, logEntry)
+		return
+	}
 	if err != nil {
 		logEntry.WithError(err).Error("Error while reading payload")
 		writeResponse(resp, http.StatusBadRequest, []byte(`{"message": "Error while reading payload"}`))
@@ -44,6 +84,21 @@ func (h *RequestHandler) HandleSuggestion(resp http.ResponseWriter, req *http.Re
 		return
 	}
 
+	diff, implied := req.URL.Query().Get(diffParam) == "true", req.URL.Query().Get(impliedParam) == "true"
+	if diff && implied {
+		logEntry.Error("Client error: diff and implied suggestions requested together")
+		writeResponse(resp, http.StatusBadRequest, []byte(`{"message": "The diff and implied query parameters can't be combined"}`))
+		return
+	}
+	if diff {
+		h.handleSuggestionDiff(resp, req, body, tid)
+		return
+	}
+	if implied {
+		h.handleImpliedSuggestions(resp, req, body, tid)
+		return
+	}
+
 	suggestions, err := h.suggester.GetSuggestions(body, tid)
 	if err != nil {
 		errMsg := "aggregating suggestions failed!"
@@ -58,7 +113,63 @@ func (h *RequestHandler) HandleSuggestion(resp http.ResponseWriter, req *http.Re
 	//ignoring marshalling errors as neither UnsupportedTypeError nor UnsupportedValueError is possible
 	jsonResponse, _ := json.Marshal(suggestions)
 
-	writeResponse(resp, http.StatusOK, jsonResponse)
+	setVariant(resp, suggestions.Variant)
+	writeCacheableResponse(resp, req, jsonResponse)
+}
+
+func (h *RequestHandler) handleSuggestionDiff(resp http.ResponseWriter, req *http.Request, body []byte, tid string) {
+	logEntry := h.log.WithTransactionID(tid)
+
+	var request diffRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		logEntry.WithError(err).Error("Client error: existing annotations are not valid")
+		writeResponse(resp, http.StatusBadRequest, []byte(`{"message": "Existing annotations should be a JSON array of annotations"}`))
+		return
+	}
+
+	diff, err := h.suggester.GetSuggestionsDiff(body, request.ExistingAnnotations, tid)
+	if err != nil {
+		errMsg := "aggregating suggestions failed!"
+		logEntry.WithError(err).Error(errMsg)
+		writeResponse(resp, http.StatusServiceUnavailable, []byte(fmt.Sprintf(`{"message": "%s"}`, errMsg)))
+		return
+	}
+
+	//ignoring marshalling errors as neither UnsupportedTypeError nor UnsupportedValueError is possible
+	jsonResponse, _ := json.Marshal(diff)
+
+	setVariant(resp, diff.Variant)
+	writeCacheableResponse(resp, req, jsonResponse)
+}
+
+func (h *RequestHandler) handleImpliedSuggestions(resp http.ResponseWriter, req *http.Request, body []byte, tid string) {
+	logEntry := h.log.WithTransactionID(tid)
+
+	implied, err := h.suggester.GetImpliedSuggestions(body, tid)
+	if err != nil {
+		errMsg := "aggregating suggestions failed!"
+		logEntry.WithError(err).Error(errMsg)
+		writeResponse(resp, http.StatusServiceUnavailable, []byte(fmt.Sprintf(`{"message": "%s"}`, errMsg)))
+		return
+	}
+
+	//ignoring marshalling errors as neither UnsupportedTypeError nor UnsupportedValueError is possible
+	jsonResponse, _ := json.Marshal(implied)
+
+	setVariant(resp, implied.Variant)
+	writeCacheableResponse(resp, req, jsonResponse)
+}
+
+// setVariant tags the response with the experiment variant which served it
+func setVariant(resp http.ResponseWriter, variant string) {
+	if variant != "" {
+		resp.Header().Set(variantHeader, variant)
+	}
+}
+
+func (h *RequestHandler) writeRequestTooLarge(resp http.ResponseWriter, logEntry *logger.LogEntry) {
+	logEntry.Errorf("Client error: payload is bigger than the maximum allowed size of %d bytes", h.maxBodySize)
+	writeResponse(resp, http.StatusRequestEntityTooLarge, []byte(fmt.Sprintf(`{"message": "Payload should not be bigger than %d bytes"}`, h.maxBodySize)))
 }
 
 func validatePayload(content []byte) (bool, error) {
@@ -77,3 +188,32 @@ func writeResponse(writer http.ResponseWriter, status int, response []byte) {
 	writer.WriteHeader(status)
 	writer.Write(response)
 }
+
+// writeCacheableResponse writes a successful response tagged with a hash of its content,
+// answering with HTTP 304 when the client already holds an identical response.
+// Unlike RFC 7232, which has other methods answered with HTTP 412, POST suggestion requests get HTTP 304 too,
+// as the suggestions of the same content are only requested again to know whether they changed. They only match actual ETags though,
+// since * would make any of their responses not modified.
+func writeCacheableResponse(writer http.ResponseWriter, req *http.Request, response []byte) {
+	hash := sha256.Sum256(response)
+	// weak validator, since the representation changes with the negotiated response compression
+	etag := fmt.Sprintf(`W/"%s"`, hex.EncodeToString(hash[:]))
+	writer.Header().Set("ETag", etag)
+
+	anyMatches := req.Method == http.MethodGet || req.Method == http.MethodHead
+	if etagMatches(req.Header.Get("If-None-Match"), etag, anyMatches) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeResponse(writer, http.StatusOK, response)
+}
+
+func etagMatches(ifNoneMatch string, etag string, anyMatches bool) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if (anyMatches && candidate == "*") || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
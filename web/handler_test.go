@@ -69,6 +69,10 @@ func (s *mockSuggesterService) GetName() string {
 	return "Mock suggester service"
 }
 
+func (s *mockSuggesterService) GetSystemID() string {
+	return "mock-suggester-service"
+}
+
 func (s *mockSuggesterService) Check() v1_1.Check {
 	args := s.Called()
 	return args.Get(0).(v1_1.Check)
@@ -130,7 +134,7 @@ func TestRequestHandler_HandleSuggestionSuccessfully(t *testing.T) {
 	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
 	service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester)
 
-	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
 	handler.HandleSuggestion(w, req)
 
 	expect.Equal(http.StatusOK, w.Code)
@@ -166,7 +170,7 @@ func TestRequestHandler_HandleSuggestionErrorOnRequestRead(t *testing.T) {
 	}, nil)
 	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
 
-	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
 	handler.HandleSuggestion(w, req)
 
 	expect.Equal(http.StatusBadRequest, w.Code)
@@ -203,7 +207,7 @@ func TestRequestHandler_HandleSuggestionEmptyBody(t *testing.T) {
 	}, nil)
 	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
 
-	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
 	handler.HandleSuggestion(w, req)
 
 	expect.Equal(http.StatusBadRequest, w.Code)
@@ -240,7 +244,7 @@ func TestRequestHandler_HandleSuggestionEmptyJsonRequest(t *testing.T) {
 	}, nil)
 	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
 
-	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
 	handler.HandleSuggestion(w, req)
 
 	expect.Equal(http.StatusBadRequest, w.Code)
@@ -279,7 +283,7 @@ func TestRequestHandler_HandleSuggestionErrorOnGetSuggestions(t *testing.T) {
 	}, nil)
 	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
 
-	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
 	handler.HandleSuggestion(w, req)
 
 	expect.Equal(http.StatusOK, w.Code)
@@ -320,7 +324,7 @@ func TestRequestHandler_HandleSuggestionOkWhenNoContentSuggestions(t *testing.T)
 	}, nil)
 	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
 
-	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
 	handler.HandleSuggestion(w, req)
 
 	expect.Equal(http.StatusOK, w.Code)
@@ -359,7 +363,7 @@ func TestRequestHandler_HandleSuggestionOkWhenEmptySuggestions(t *testing.T) {
 	}, nil)
 	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
 
-	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
 	handler.HandleSuggestion(w, req)
 
 	expect.Equal(http.StatusOK, w.Code)
@@ -396,6 +400,11 @@ func TestRequestHandler_HandleSuggestionErrorOnGetConcordance(t *testing.T) {
 		},
 	}}, nil)
 	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{}, errors.New("timeout error"))
+	// broader concepts are looked up concurrently with the concordances
+	mockPublicThings.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"things":{}}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
 
 	broaderService := &service.BroaderConceptsProvider{
 		Client: mockPublicThings,
@@ -409,7 +418,7 @@ func TestRequestHandler_HandleSuggestionErrorOnGetConcordance(t *testing.T) {
 	}, nil)
 	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
 
-	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
 	handler.HandleSuggestion(w, req)
 
 	expect.Equal(http.StatusServiceUnavailable, w.Code)
@@ -419,3 +428,291 @@ func TestRequestHandler_HandleSuggestionErrorOnGetConcordance(t *testing.T) {
 	mockPublicThings.AssertExpectations(t)
 	mockClient.AssertExpectations(t)
 }
+
+func TestRequestHandler_HandleSuggestionDiff(t *testing.T) {
+	expect := assert.New(t)
+
+	body := []byte(`{"bodyXML":"Test body","existingAnnotations":[{"id":"http://www.ft.com/thing/existing-concept","predicate":"http://www.ft.com/ontology/annotation/about"}]}`)
+	req := httptest.NewRequest("POST", "/content/suggest?diff=true", bytes.NewReader(body))
+	req.Header.Add("X-Request-Id", "tid_test")
+	w := httptest.NewRecorder()
+
+	log := logger.NewUPPLogger("test-logger", "panic")
+	mockClient := new(mockHttpClient)
+	mockSuggester := new(mockSuggesterService)
+	mockPublicThings := new(mockHttpClient)
+	mockConcordance := &service.ConcordanceService{ConcordanceBaseURL: "concordanceBaseURL", ConcordanceEndpoint: "concordanceEndpoint", Client: mockClient}
+
+	mockSuggester.On("GetSuggestions", []byte(`{"bodyXML":"Test body"}`), "tid_test").Return(service.SuggestionsResponse{Suggestions: []service.Suggestion{}}, nil)
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"concepts":{"existing-concept":{"id":"http://www.ft.com/thing/existing-concept","prefLabel":"Existing","type":"http://www.ft.com/ontology/Topic"}}}`)),
+		StatusCode: http.StatusOK,
+	}, nil)
+
+	broaderService := &service.BroaderConceptsProvider{
+		Client: mockPublicThings,
+	}
+
+	blacklisterMock := new(mockHttpClient)
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body: ioutil.NopCloser(strings.NewReader(
+			`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil)
+	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
+
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusOK, w.Code)
+	expect.Equal(`{"added":[],"alreadyPresent":[],"existingButNotSuggested":[{"id":"http://www.ft.com/thing/existing-concept","type":"http://www.ft.com/ontology/Topic","prefLabel":"Existing","predicate":"http://www.ft.com/ontology/annotation/about"}]}`, w.Body.String())
+
+	mockSuggester.AssertExpectations(t)
+	mockPublicThings.AssertExpectations(t) //no calls
+	mockClient.AssertExpectations(t)
+}
+
+func TestRequestHandler_HandleSuggestionDiffInvalidExistingAnnotations(t *testing.T) {
+	expect := assert.New(t)
+
+	body := []byte(`{"bodyXML":"Test body","existingAnnotations":"not-an-array"}`)
+	req := httptest.NewRequest("POST", "/content/suggest?diff=true", bytes.NewReader(body))
+	req.Header.Add("X-Request-Id", "tid_test")
+	w := httptest.NewRecorder()
+
+	log := logger.NewUPPLogger("test-logger", "panic")
+	mockSuggester := new(mockSuggesterService)
+
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, &service.ConcordanceService{}, &service.BroaderConceptsProvider{}, nil, mockSuggester), log, 0)
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusBadRequest, w.Code)
+	expect.Equal(`{"message": "Existing annotations should be a JSON array of annotations"}`, w.Body.String())
+
+	mockSuggester.AssertExpectations(t) //no calls
+}
+
+func TestRequestHandler_HandleSuggestionDiffAndImpliedRejected(t *testing.T) {
+	expect := assert.New(t)
+
+	body := []byte(`{"bodyXML":"Test body","existingAnnotations":[]}`)
+	req := httptest.NewRequest("POST", "/content/suggest?diff=true&implied=true", bytes.NewReader(body))
+	req.Header.Add("X-Request-Id", "tid_test")
+	w := httptest.NewRecorder()
+
+	log := logger.NewUPPLogger("test-logger", "panic")
+	mockSuggester := new(mockSuggesterService)
+
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, &service.ConcordanceService{}, &service.BroaderConceptsProvider{}, nil, mockSuggester), log, 0)
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusBadRequest, w.Code)
+	expect.Equal(`{"message": "The diff and implied query parameters can't be combined"}`, w.Body.String())
+
+	mockSuggester.AssertExpectations(t) //no calls
+}
+
+func TestRequestHandler_HandleImpliedSuggestions(t *testing.T) {
+	expect := assert.New(t)
+
+	body := []byte(`{"bodyXML":"Test body"}`)
+	req := httptest.NewRequest("POST", "/content/suggest?implied=true", bytes.NewReader(body))
+	req.Header.Add("X-Request-Id", "tid_test")
+	w := httptest.NewRecorder()
+
+	log := logger.NewUPPLogger("test-logger", "panic")
+	mockClient := new(mockHttpClient)
+	mockSuggester := new(mockSuggesterService)
+	mockPublicThings := new(mockHttpClient)
+	mockConcordance := &service.ConcordanceService{ConcordanceBaseURL: "concordanceBaseURL", ConcordanceEndpoint: "concordanceEndpoint", Client: mockClient}
+
+	paris := service.Suggestion{Concept: service.Concept{ID: "http://www.ft.com/thing/paris", PrefLabel: "Paris", Type: "http://www.ft.com/ontology/Location"}}
+	mockSuggester.On("GetSuggestions", body, "tid_test").Return(service.SuggestionsResponse{Suggestions: []service.Suggestion{paris}}, nil)
+	mockSuggester.On("FilterSuggestions", []service.Suggestion{paris}).Return([]service.Suggestion{paris})
+	// concordances for the suggestions, then for the implied concepts
+	for i := 0; i < 2; i++ {
+		mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+			Body: ioutil.NopCloser(strings.NewReader(`{"concepts":{
+				"paris":{"id":"http://www.ft.com/thing/paris","prefLabel":"Paris","type":"http://www.ft.com/ontology/Location"},
+				"france":{"id":"http://www.ft.com/thing/france","prefLabel":"France","type":"http://www.ft.com/ontology/Location"}}}`)),
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+	}
+	// broader concepts for the exclusion, then for the implied concepts
+	for i := 0; i < 2; i++ {
+		mockPublicThings.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+			Body:       ioutil.NopCloser(strings.NewReader(`{"things":{"paris":{"id":"http://www.ft.com/thing/paris","broaderConcepts":[{"id":"http://www.ft.com/thing/france"}]}}}`)),
+			StatusCode: http.StatusOK,
+		}, nil).Once()
+	}
+
+	broaderService := &service.BroaderConceptsProvider{
+		Client: mockPublicThings,
+	}
+
+	blacklisterMock := new(mockHttpClient)
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil).Once()
+	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
+
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, broaderService, blacklister, mockSuggester), log, 0)
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusOK, w.Code)
+	expect.Equal(`{"suggestions":[{"id":"http://www.ft.com/thing/paris","type":"http://www.ft.com/ontology/Location","prefLabel":"Paris"}],"implied":[{"id":"http://www.ft.com/thing/france","type":"http://www.ft.com/ontology/Location","prefLabel":"France","impliedBy":["http://www.ft.com/thing/paris"]}]}`, w.Body.String())
+
+	mockSuggester.AssertExpectations(t)
+	mockPublicThings.AssertExpectations(t)
+	mockClient.AssertExpectations(t)
+}
+
+func TestRequestHandler_HandleSuggestionRequestTooLarge(t *testing.T) {
+	expect := assert.New(t)
+
+	body := []byte(`{"bodyXML":"Test body that is too large"}`)
+
+	log := logger.NewUPPLogger("test-logger", "panic")
+	mockSuggester := new(mockSuggesterService)
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, &service.ConcordanceService{}, &service.BroaderConceptsProvider{}, nil, mockSuggester), log, 16)
+	oversizeBefore := handler.oversizeRequests.Count()
+
+	// rejected by the declared content length
+	req := httptest.NewRequest("POST", "/content/suggest", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusRequestEntityTooLarge, w.Code)
+	expect.Equal(`{"message": "Payload should not be bigger than 16 bytes"}`, w.Body.String())
+
+	// rejected while reading a body of unknown length
+	req = httptest.NewRequest("POST", "/content/suggest", ioutil.NopCloser(bytes.NewReader(body)))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusRequestEntityTooLarge, w.Code)
+	expect.Equal(oversizeBefore+2, handler.oversizeRequests.Count())
+
+	mockSuggester.AssertExpectations(t) //no calls
+}
+
+func TestRequestHandler_HandleSuggestionNotModified(t *testing.T) {
+	expect := assert.New(t)
+
+	body := []byte(`{"bodyXML":"Test body"}`)
+
+	log := logger.NewUPPLogger("test-logger", "panic")
+	mockClient := new(mockHttpClient)
+	mockSuggester := new(mockSuggesterService)
+	mockConcordance := &service.ConcordanceService{ConcordanceBaseURL: "concordanceBaseURL", ConcordanceEndpoint: "concordanceEndpoint", Client: mockClient}
+
+	mockSuggester.On("GetSuggestions", body, "tid_test").Return(service.SuggestionsResponse{Suggestions: []service.Suggestion{}}, nil)
+
+	blacklisterMock := new(mockHttpClient)
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body: ioutil.NopCloser(strings.NewReader(
+			`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil)
+	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
+
+	handler := NewRequestHandler(service.NewAggregateSuggester(log, mockConcordance, &service.BroaderConceptsProvider{}, blacklister, mockSuggester), log, 0)
+
+	req := httptest.NewRequest("POST", "/content/suggest", bytes.NewReader(body))
+	req.Header.Add("X-Request-Id", "tid_test")
+	w := httptest.NewRecorder()
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	expect.Equal(`W/"af108ed5835ba2c1320747128a7aca01bdf87937bc05027f156c6751ed2de078"`, etag)
+
+	req = httptest.NewRequest("POST", "/content/suggest", bytes.NewReader(body))
+	req.Header.Add("X-Request-Id", "tid_test")
+	req.Header.Add("If-None-Match", `W/"another-etag", `+etag)
+	w = httptest.NewRecorder()
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusNotModified, w.Code)
+	expect.Equal(etag, w.Header().Get("ETag"))
+	expect.Empty(w.Body.String())
+
+	req = httptest.NewRequest("POST", "/content/suggest", bytes.NewReader(body))
+	req.Header.Add("X-Request-Id", "tid_test")
+	req.Header.Add("If-None-Match", `W/"another-etag"`)
+	w = httptest.NewRecorder()
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusOK, w.Code)
+	expect.Equal(`{"suggestions":[]}`, w.Body.String())
+
+	mockSuggester.AssertExpectations(t)
+	mockClient.AssertExpectations(t) //no calls
+}
+
+func TestRequestHandler_HandleSuggestionTagsExperimentVariant(t *testing.T) {
+	expect := assert.New(t)
+
+	body := []byte(`{"id":"http://www.ft.com/content/9d5e441e-0b02-11e8-8eb7-42f857ea9f0","bodyXML":"Test body"}`)
+
+	log := logger.NewUPPLogger("test-logger", "panic")
+	mockClient := new(mockHttpClient)
+	mockSuggester := new(mockSuggesterService)
+	mockConcordance := &service.ConcordanceService{ConcordanceBaseURL: "concordanceBaseURL", ConcordanceEndpoint: "concordanceEndpoint", Client: mockClient}
+
+	mockSuggester.On("GetSuggestions", mock.AnythingOfType("[]uint8"), "tid_test").Return(service.SuggestionsResponse{Suggestions: []service.Suggestion{}}, nil)
+
+	blacklisterMock := new(mockHttpClient)
+	blacklisterMock.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		Body: ioutil.NopCloser(strings.NewReader(
+			`{"uuids":[]}`)),
+		StatusCode: http.StatusOK,
+	}, nil)
+	blacklister := service.NewConceptBlacklister("blacklisterUrl", "blacklisterEndpoint", blacklisterMock)
+
+	suggester := service.NewAggregateSuggester(log, mockConcordance, &service.BroaderConceptsProvider{}, blacklister)
+	suggester.Experiment = &service.Experiment{Name: "new-model", Percentage: 100, Suggesters: []service.Suggester{mockSuggester}}
+	handler := NewRequestHandler(suggester, log, 0)
+
+	req := httptest.NewRequest("POST", "/content/suggest", bytes.NewReader(body))
+	req.Header.Add("X-Request-Id", "tid_test")
+	w := httptest.NewRecorder()
+	handler.HandleSuggestion(w, req)
+
+	expect.Equal(http.StatusOK, w.Code)
+	expect.Equal("new-model", w.Header().Get("X-Suggestions-Variant"))
+	expect.Equal(`{"suggestions":[]}`, w.Body.String())
+
+	mockSuggester.AssertExpectations(t)
+	mockClient.AssertExpectations(t) //no calls
+}
+
+func TestWriteCacheableResponse_NotModified(t *testing.T) {
+	testCases := []struct {
+		method      string
+		ifNoneMatch string
+		expected    int
+	}{
+		{method: http.MethodGet, ifNoneMatch: `W/"another-etag", "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`, expected: http.StatusNotModified},
+		{method: http.MethodHead, ifNoneMatch: "*", expected: http.StatusNotModified},
+		{method: http.MethodGet, ifNoneMatch: `W/"another-etag"`, expected: http.StatusOK},
+		{method: http.MethodPost, ifNoneMatch: `W/"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`, expected: http.StatusNotModified},
+		{method: http.MethodPost, ifNoneMatch: "*", expected: http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(testCase.method, "/content/suggest", nil)
+		req.Header.Set("If-None-Match", testCase.ifNoneMatch)
+		w := httptest.NewRecorder()
+		writeCacheableResponse(w, req, []byte("test"))
+
+		assert.Equal(t, testCase.expected, w.Code, testCase.method+" "+testCase.ifNoneMatch)
+		assert.Equal(t, `W/"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`, w.Header().Get("ETag"))
+	}
+}
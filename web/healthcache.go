@@ -0,0 +1,186 @@
+package web
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const healthTimeFormat = time.RFC3339
+
+// cachedCheck keeps the latest result of a health check refreshed in the background,
+// so that serving the health and GTG endpoints does not call the downstream services.
+type cachedCheck struct {
+	checker     func() (string, error)
+	timeout     time.Duration
+	mutex       sync.RWMutex
+	refreshing  bool
+	ready       chan struct{}
+	readyOnce   sync.Once
+	output      string
+	err         error
+	lastChecked time.Time
+	lastSuccess time.Time
+	now         func() time.Time
+}
+
+func newCachedCheck(checker func() (string, error), timeout time.Duration) *cachedCheck {
+	return &cachedCheck{checker: checker, timeout: timeout, ready: make(chan struct{}), now: time.Now}
+}
+
+// refresh runs the check, unless the previous run is still waiting for a slow downstream service
+func (c *cachedCheck) refresh() {
+	if c.start() {
+		c.run()
+	}
+}
+
+// refreshInBackground is like refresh without waiting for the check to complete
+func (c *cachedCheck) refreshInBackground() {
+	if c.start() {
+		go c.run()
+	}
+}
+
+func (c *cachedCheck) start() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.refreshing {
+		return false
+	}
+	c.refreshing = true
+	return true
+}
+
+// run records the result of the check, or a timeout error when the check takes too long.
+// The check keeps refreshing until the checker returns, so that a stuck checker is never run twice.
+func (c *cachedCheck) run() {
+	results := startCheck(c.checker)
+	result, completed := awaitCheck(results, c.timeout)
+	c.record(result)
+	if completed {
+		c.finish()
+		return
+	}
+	go func() {
+		<-results
+		c.finish()
+	}()
+}
+
+func (c *cachedCheck) record(result checkResult) {
+	c.mutex.Lock()
+	c.output = result.output
+	c.err = result.err
+	c.lastChecked = c.now()
+	if result.err == nil {
+		c.lastSuccess = c.lastChecked
+	}
+	c.mutex.Unlock()
+	c.readyOnce.Do(func() { close(c.ready) })
+}
+
+func (c *cachedCheck) finish() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.refreshing = false
+}
+
+type checkResult struct {
+	output string
+	err    error
+}
+
+// runCheck runs the checker, giving up waiting for it after the timeout unless the timeout is not positive
+func runCheck(checker func() (string, error), timeout time.Duration) (string, error) {
+	result, _ := awaitCheck(startCheck(checker), timeout)
+	return result.output, result.err
+}
+
+func startCheck(checker func() (string, error)) <-chan checkResult {
+	results := make(chan checkResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				results <- checkResult{err: fmt.Errorf("health check panicked: %v", r)}
+			}
+		}()
+		output, err := checker()
+		results <- checkResult{output, err}
+	}()
+	return results
+}
+
+// awaitCheck waits for the result of the check, a timeout error being returned with false when the check takes too long
+func awaitCheck(results <-chan checkResult, timeout time.Duration) (checkResult, bool) {
+	if timeout <= 0 {
+		return <-results, true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		return result, true
+	case <-timer.C:
+		return checkResult{err: fmt.Errorf("Timed out after %v second(s)", timeout.Seconds())}, false
+	}
+}
+
+// result returns the latest cached result with its timestamps, waiting for the first run of the check to complete
+func (c *cachedCheck) result() (string, error) {
+	select {
+	case <-c.ready:
+	default:
+		c.refresh()
+		<-c.ready
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	lastSuccess := "never"
+	if !c.lastSuccess.IsZero() {
+		lastSuccess = c.lastSuccess.Format(healthTimeFormat)
+	}
+	timestamps := fmt.Sprintf("checked at %s, last success at %s", c.lastChecked.Format(healthTimeFormat), lastSuccess)
+	if c.err != nil {
+		return "", fmt.Errorf("%s (%s)", c.err.Error(), timestamps)
+	}
+	return fmt.Sprintf("%s (%s)", c.output, timestamps), nil
+}
+
+// RunChecksInBackground runs all the health checks every interval and makes the health and GTG endpoints serve their latest results
+// instead of calling the downstream services on each request. It returns a function stopping the background checks.
+func (service *HealthService) RunChecksInBackground(interval time.Duration) (stop func()) {
+	cached := make([]*cachedCheck, len(service.Checks))
+	for i := range service.Checks {
+		cached[i] = newCachedCheck(service.Checks[i].Checker, service.Timeout)
+		service.Checks[i].Checker = cached[i].result
+	}
+
+	refreshAll := func() {
+		for _, c := range cached {
+			c.refreshInBackground()
+		}
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	refreshAll()
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refreshAll()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"fmt"
 	"time"
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
@@ -35,6 +36,45 @@ func NewHealthService(appSystemCode string, appName string, appDescription strin
 
 }
 
+// SetCriticalChecks makes GTG fail whenever one of the checks with the given IDs fails.
+// Without critical checks the service is always good to go.
+func (service *HealthService) SetCriticalChecks(ids []string) error {
+	var gtgChecks []gtg.StatusChecker
+	for _, id := range ids {
+		index, found := service.findCheck(id)
+		if !found {
+			return fmt.Errorf("unknown critical health check %q", id)
+		}
+		gtgChecks = append(gtgChecks, service.newGTGCheck(index))
+	}
+
+	if len(gtgChecks) > 0 {
+		service.gtgChecks = gtgChecks
+	}
+	return nil
+}
+
+func (service *HealthService) findCheck(id string) (int, bool) {
+	for i, check := range service.Checks {
+		if check.ID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// newGTGCheck looks the check up on each call, so that it uses the cached results once the checks run in the background.
+// Without background checks, the downstream service is called within the timeout of the health checks.
+func (service *HealthService) newGTGCheck(index int) gtg.StatusChecker {
+	return func() gtg.Status {
+		check := service.Checks[index]
+		if _, err := runCheck(check.Checker, service.Timeout); err != nil {
+			return gtg.Status{GoodToGo: false, Message: fmt.Sprintf("%s: %s", check.Name, err.Error())}
+		}
+		return gtg.Status{GoodToGo: true}
+	}
+}
+
 func (service *HealthService) GTG() gtg.Status {
 	return gtg.FailFastParallelCheck(service.gtgChecks)()
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"errors"
+	"sync/atomic"
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/stretchr/testify/assert"
@@ -59,3 +60,177 @@ func TestHealthService_GTGSuccessfullyWhenHealthError(t *testing.T) {
 	expect.Equal("", status.Message)
 	expect.True(status.GoodToGo)
 }
+
+func TestHealthService_GTGFailsOnCriticalCheck(t *testing.T) {
+	expect := assert.New(t)
+
+	critical := fthealth.Check{ID: "internal-concordances", Name: "internal-concordances Healthcheck", Checker: func() (string, error) {
+		return "", errors.New("everything-is-error")
+	}}
+	nonCritical := fthealth.Check{ID: "public-things-api", Name: "public-things-api Healthcheck", Checker: func() (string, error) {
+		return "", errors.New("everything-is-error")
+	}}
+
+	healthService := NewHealthService("", "", "", critical, nonCritical)
+	expect.True(healthService.GTG().GoodToGo)
+
+	err := healthService.SetCriticalChecks([]string{"internal-concordances"})
+	expect.NoError(err)
+
+	status := healthService.GTG()
+	expect.False(status.GoodToGo)
+	expect.Equal("internal-concordances Healthcheck: everything-is-error", status.Message)
+}
+
+func TestHealthService_GTGSuccessfullyWhenOnlyNonCriticalChecksFail(t *testing.T) {
+	expect := assert.New(t)
+
+	critical := fthealth.Check{ID: "internal-concordances", Name: "internal-concordances Healthcheck", Checker: func() (string, error) {
+		return "internal-concordances is healthy", nil
+	}}
+	nonCritical := fthealth.Check{ID: "public-things-api", Name: "public-things-api Healthcheck", Checker: func() (string, error) {
+		return "", errors.New("everything-is-error")
+	}}
+
+	healthService := NewHealthService("", "", "", critical, nonCritical)
+	err := healthService.SetCriticalChecks([]string{"internal-concordances"})
+	expect.NoError(err)
+
+	expect.True(healthService.GTG().GoodToGo)
+}
+
+func TestHealthService_SetCriticalChecksUnknownCheck(t *testing.T) {
+	expect := assert.New(t)
+
+	healthService := NewHealthService("", "", "")
+	err := healthService.SetCriticalChecks([]string{"unknown-check"})
+
+	expect.EqualError(err, `unknown critical health check "unknown-check"`)
+	expect.True(healthService.GTG().GoodToGo)
+}
+
+func TestHealthService_RunChecksInBackgroundServesCachedResults(t *testing.T) {
+	expect := assert.New(t)
+
+	var calls int32
+	check := fthealth.Check{ID: "public-things-api", Name: "public-things-api Healthcheck", Checker: func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "public-things-api is healthy", nil
+	}}
+
+	healthService := NewHealthService("", "", "", check)
+	stop := healthService.RunChecksInBackground(time.Hour)
+	defer stop()
+
+	for i := 0; i < 5; i++ {
+		result := fthealth.RunCheck(healthService)
+		expect.True(result.Ok)
+		expect.Regexp(`^public-things-api is healthy \(checked at .+, last success at .+\)$`, result.Checks[0].CheckOutput)
+	}
+	expect.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHealthService_RunChecksInBackgroundRefreshesResults(t *testing.T) {
+	expect := assert.New(t)
+
+	var calls int32
+	check := fthealth.Check{ID: "public-things-api", Name: "public-things-api Healthcheck", Checker: func() (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return "public-things-api is healthy", nil
+		}
+		return "", errors.New("everything-is-error")
+	}}
+
+	healthService := NewHealthService("", "", "", check)
+	expect.NoError(healthService.SetCriticalChecks([]string{"public-things-api"}))
+	stop := healthService.RunChecksInBackground(10 * time.Millisecond)
+	defer stop()
+
+	expect.True(fthealth.RunCheck(healthService).Ok)
+	deadline := time.Now().Add(time.Second)
+	for healthService.GTG().GoodToGo && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	expect.False(healthService.GTG().GoodToGo)
+
+	result := fthealth.RunCheck(healthService)
+	expect.False(result.Ok)
+	expect.Regexp(`^everything-is-error \(checked at .+, last success at .+\)$`, result.Checks[0].CheckOutput)
+	expect.NotContains(result.Checks[0].CheckOutput, "last success at never")
+}
+
+func TestCachedCheckNeverSucceeded(t *testing.T) {
+	expect := assert.New(t)
+
+	checkedAt := time.Date(2020, 5, 4, 10, 30, 0, 0, time.UTC)
+	c := newCachedCheck(func() (string, error) {
+		return "", errors.New("everything-is-error")
+	}, time.Second)
+	c.now = func() time.Time { return checkedAt }
+
+	_, err := c.result()
+	expect.EqualError(err, "everything-is-error (checked at 2020-05-04T10:30:00Z, last success at never)")
+}
+
+func TestCachedCheckTimesOut(t *testing.T) {
+	expect := assert.New(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	c := newCachedCheck(func() (string, error) {
+		<-release
+		return "too late", nil
+	}, 10*time.Millisecond)
+
+	_, err := c.result()
+	expect.Error(err)
+	expect.Contains(err.Error(), "Timed out after 0.01 second(s)")
+}
+
+func TestHealthService_GTGTimesOutOnHangingCriticalCheck(t *testing.T) {
+	expect := assert.New(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	critical := fthealth.Check{ID: "internal-concordances", Name: "internal-concordances Healthcheck", Checker: func() (string, error) {
+		<-release
+		return "internal-concordances is healthy", nil
+	}}
+
+	healthService := NewHealthService("", "", "", critical)
+	healthService.Timeout = 10 * time.Millisecond
+	expect.NoError(healthService.SetCriticalChecks([]string{"internal-concordances"}))
+
+	status := healthService.GTG()
+	expect.False(status.GoodToGo)
+	expect.Equal("internal-concordances Healthcheck: Timed out after 0.01 second(s)", status.Message)
+}
+
+func TestCachedCheckTimedOutIsNotRunAgainUntilItReturns(t *testing.T) {
+	expect := assert.New(t)
+
+	var calls int32
+	release := make(chan struct{})
+	c := newCachedCheck(func() (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+		}
+		return "public-things-api is healthy", nil
+	}, 10*time.Millisecond)
+
+	c.refresh()
+	c.refresh()
+	_, err := c.result()
+	expect.Error(err)
+	expect.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) == 1 && time.Now().Before(deadline) {
+		c.refresh()
+		time.Sleep(5 * time.Millisecond)
+	}
+	expect.Equal(int32(2), atomic.LoadInt32(&calls))
+	_, err = c.result()
+	expect.NoError(err)
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	defaultRateLimitClient = "default"
+	idleBucketsSweepPeriod = 10 * time.Minute
+	// maxRateLimitBuckets bounds the memory used by clients sending many different identifiers
+	maxRateLimitBuckets = 10000
+)
+
+// RateLimit allows Rate requests per second, with bursts of up to Burst requests. A Rate of zero or less means no limit.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// ParseRateLimits reads per client rate limits configured as a JSON object, e.g. {"client-a": {"rate": 10, "burst": 20}}
+func ParseRateLimits(config string) (map[string]RateLimit, error) {
+	limits := map[string]RateLimit{}
+	if config == "" {
+		return limits, nil
+	}
+	if err := json.Unmarshal([]byte(config), &limits); err != nil {
+		return nil, fmt.Errorf("invalid rate limits configuration: %w", err)
+	}
+	return limits, nil
+}
+
+// RateLimiter throttles requests with a token bucket per client, clients being identified by the value of the configured header,
+// or by their remote address when they don't send it, which is the address of the gateway for the requests coming through one.
+// Clients without a configured rate limit get their own bucket with the default rate limit.
+// Once maxBuckets clients are tracked, the buckets of the clients seen least recently make way for the new ones.
+type RateLimiter struct {
+	header       string
+	defaultLimit RateLimit
+	limits       map[string]RateLimit
+	mutex        sync.Mutex
+	buckets      map[string]*list.Element
+	lru          *list.List
+	maxBuckets   int
+	lastSweep    time.Time
+	now          func() time.Time
+	throttled    map[string]metrics.Counter
+}
+
+func NewRateLimiter(header string, defaultLimit RateLimit, limits map[string]RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		header:       header,
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		buckets:      map[string]*list.Element{},
+		lru:          list.New(),
+		maxBuckets:   maxRateLimitBuckets,
+		now:          time.Now,
+		throttled:    map[string]metrics.Counter{},
+	}
+	l.lastSweep = l.now()
+	// client identifiers might be secret, so only configured ones are used for metric names
+	l.throttled[defaultRateLimitClient] = metrics.GetOrRegisterCounter("ratelimit.throttled."+defaultRateLimitClient, metrics.DefaultRegistry)
+	for client := range limits {
+		l.throttled[client] = metrics.GetOrRegisterCounter("ratelimit.throttled."+client, metrics.DefaultRegistry)
+	}
+	return l
+}
+
+func (l *RateLimiter) Handler(next http.Handler) http.Handler {
+	if l.header == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, retryAfter := l.allow(l.client(r))
+		if !allowed {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Max(1, math.Ceil(retryAfter.Seconds())))))
+			writeResponse(w, http.StatusTooManyRequests, []byte(`{"message": "Rate limit exceeded, please retry later"}`))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// client identifies the client of the request, the remote address of the clients without the header
+// being prefixed so that it never matches a configured client
+func (l *RateLimiter) client(r *http.Request) string {
+	if client := r.Header.Get(l.header); client != "" {
+		return client
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "remote-address " + host
+}
+
+func (l *RateLimiter) allow(client string) (bool, time.Duration) {
+	limit, configured := l.limits[client]
+	if !configured {
+		limit = l.defaultLimit
+	}
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweepIdleBuckets(now)
+
+	var bucket *tokenBucket
+	if element, ok := l.buckets[client]; ok {
+		bucket = element.Value.(*tokenBucket)
+		l.lru.MoveToFront(element)
+	} else {
+		for l.lru.Len() >= l.maxBuckets {
+			l.removeElement(l.lru.Back())
+		}
+		bucket = newTokenBucket(client, limit, now)
+		l.buckets[client] = l.lru.PushFront(bucket)
+	}
+
+	allowed, retryAfter := bucket.take(now)
+	if !allowed {
+		if configured {
+			l.throttled[client].Inc(1)
+		} else {
+			l.throttled[defaultRateLimitClient].Inc(1)
+		}
+	}
+	return allowed, retryAfter
+}
+
+// sweepIdleBuckets drops the buckets of clients not seen recently, which are full again anyway
+func (l *RateLimiter) sweepIdleBuckets(now time.Time) {
+	if now.Sub(l.lastSweep) < idleBucketsSweepPeriod {
+		return
+	}
+	// the buckets are ordered from the most to the least recently used
+	for element := l.lru.Back(); element != nil && now.Sub(element.Value.(*tokenBucket).last) >= idleBucketsSweepPeriod; element = l.lru.Back() {
+		l.removeElement(element)
+	}
+	l.lastSweep = now
+}
+
+func (l *RateLimiter) removeElement(element *list.Element) {
+	l.lru.Remove(element)
+	delete(l.buckets, element.Value.(*tokenBucket).client)
+}
+
+type tokenBucket struct {
+	client string
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(client string, limit RateLimit, now time.Time) *tokenBucket {
+	burst := math.Max(1, float64(limit.Burst))
+	return &tokenBucket{
+		client: client,
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
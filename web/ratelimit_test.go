@@ -0,0 +1,137 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitedRequest(handler http.Handler, client string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/content/suggest", nil)
+	if client != "" {
+		req.Header.Set("X-Api-Key", client)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestParseRateLimits(t *testing.T) {
+	expect := assert.New(t)
+
+	limits, err := ParseRateLimits(`{"client-a": {"rate": 10, "burst": 20}, "client-b": {"rate": 0.5}}`)
+	expect.NoError(err)
+	expect.Equal(map[string]RateLimit{"client-a": {Rate: 10, Burst: 20}, "client-b": {Rate: 0.5}}, limits)
+
+	limits, err = ParseRateLimits("")
+	expect.NoError(err)
+	expect.Empty(limits)
+
+	_, err = ParseRateLimits("client-a=10")
+	expect.Error(err)
+}
+
+func TestRateLimiter_ThrottlesPerClient(t *testing.T) {
+	expect := assert.New(t)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter("X-Api-Key", RateLimit{Rate: 1, Burst: 1}, map[string]RateLimit{"client-a": {Rate: 2, Burst: 2}})
+	limiter.now = func() time.Time { return now }
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	throttledBefore := limiter.throttled["client-a"].Count()
+	throttledDefaultBefore := limiter.throttled[defaultRateLimitClient].Count()
+
+	expect.Equal(http.StatusOK, rateLimitedRequest(handler, "client-a").Code)
+	expect.Equal(http.StatusOK, rateLimitedRequest(handler, "client-a").Code)
+	w := rateLimitedRequest(handler, "client-a")
+	expect.Equal(http.StatusTooManyRequests, w.Code)
+	expect.Equal("1", w.Header().Get("Retry-After"))
+	expect.Equal(`{"message": "Rate limit exceeded, please retry later"}`, w.Body.String())
+	expect.Equal(throttledBefore+1, limiter.throttled["client-a"].Count())
+
+	// other clients have their own buckets with the default limit
+	expect.Equal(http.StatusOK, rateLimitedRequest(handler, "client-b").Code)
+	expect.Equal(http.StatusTooManyRequests, rateLimitedRequest(handler, "client-b").Code)
+	expect.Equal(http.StatusOK, rateLimitedRequest(handler, "client-c").Code)
+	expect.Equal(throttledDefaultBefore+1, limiter.throttled[defaultRateLimitClient].Count())
+
+	// tokens are refilled over time
+	now = now.Add(500 * time.Millisecond)
+	expect.Equal(http.StatusOK, rateLimitedRequest(handler, "client-a").Code)
+	expect.Equal(http.StatusTooManyRequests, rateLimitedRequest(handler, "client-b").Code)
+	now = now.Add(500 * time.Millisecond)
+	expect.Equal(http.StatusOK, rateLimitedRequest(handler, "client-b").Code)
+}
+
+func TestRateLimiter_Unlimited(t *testing.T) {
+	expect := assert.New(t)
+
+	limiter := NewRateLimiter("X-Api-Key", RateLimit{}, map[string]RateLimit{"client-a": {Rate: 1, Burst: 1}})
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 10; i++ {
+		expect.Equal(http.StatusOK, rateLimitedRequest(handler, "").Code)
+		expect.Equal(http.StatusOK, rateLimitedRequest(handler, "client-b").Code)
+	}
+	expect.Empty(limiter.buckets)
+}
+
+func TestRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	expect := assert.New(t)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter("X-Api-Key", RateLimit{Rate: 1, Burst: 1}, nil)
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rateLimitedRequest(handler, "client-a")
+	now = now.Add(idleBucketsSweepPeriod)
+	rateLimitedRequest(handler, "client-b")
+
+	expect.Len(limiter.buckets, 1)
+	expect.Contains(limiter.buckets, "client-b")
+}
+
+func TestRateLimiter_ClientsWithoutHeaderIdentifiedByRemoteAddress(t *testing.T) {
+	expect := assert.New(t)
+
+	limiter := NewRateLimiter("X-Api-Key", RateLimit{Rate: 1, Burst: 1}, map[string]RateLimit{"": {Rate: 100, Burst: 100}})
+	limiter.now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(remoteAddr string) int {
+		req := httptest.NewRequest("POST", "/content/suggest", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	expect.Equal(http.StatusOK, request("10.0.0.1:1234"))
+	// the port changes with each connection of the same client
+	expect.Equal(http.StatusTooManyRequests, request("10.0.0.1:5678"))
+	expect.Equal(http.StatusOK, request("10.0.0.2:1234"))
+}
+
+func TestRateLimiter_EvictsLeastRecentBucketsOverTheMaximum(t *testing.T) {
+	expect := assert.New(t)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter("X-Api-Key", RateLimit{Rate: 1, Burst: 1}, nil)
+	limiter.now = func() time.Time { return now }
+	limiter.maxBuckets = 2
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, client := range []string{"client-a", "client-b", "client-c"} {
+		rateLimitedRequest(handler, client)
+		now = now.Add(time.Millisecond)
+	}
+
+	expect.Len(limiter.buckets, 2)
+	expect.Contains(limiter.buckets, "client-b")
+	expect.Contains(limiter.buckets, "client-c")
+}